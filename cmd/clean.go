@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/innovation-upstream/codema/internal/manifest"
+	"github.com/innovation-upstream/codema/internal/target"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var cleanTargetsRaw string
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove generated files",
+	Long:  `Remove the generated files recorded in the manifest, for all or specific targets. Files that were edited since they were generated are left in place.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := cleanGeneratedFiles()
+		if err != nil {
+			fmt.Printf("Error cleaning: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cleanCmd.Flags().StringVarP(&cleanTargetsRaw, "targets", "t", "*", "Targets to clean")
+}
+
+func cleanGeneratedFiles() error {
+	isAllTargets := cleanTargetsRaw == "*"
+	targetsToClean := TargetFlags(strings.Split(cleanTargetsRaw, ",")).TrimSpace()
+
+	mf, err := manifest.Load(manifestPath)
+	if err != nil {
+		return err
+	}
+	mergeBases, err := target.NewMergeBases(mergeBasePath)
+	if err != nil {
+		return err
+	}
+
+	var files []manifest.Entry
+	var removed, edited, failed int
+	for _, e := range mf.Files {
+		if !isAllTargets && !targetsToClean.Includes(e.Target) {
+			files = append(files, e)
+			continue
+		}
+
+		// Keep going, so the manifest is saved for the files that were removed
+		status, err := mf.Remove(e)
+		if err != nil {
+			failed++
+			files = append(files, e)
+			fmt.Printf("Error removing %s: %v\n", e.Path, err)
+			continue
+		}
+
+		if status == manifest.Removed || status == manifest.Missing {
+			err := mergeBases.Remove(mf.AbsPath(e))
+			if err != nil {
+				fmt.Printf("WARN Failed to remove the merge base of %s: %v\n", e.Path, err)
+			}
+		}
+
+		switch status {
+		case manifest.Removed:
+			removed++
+			fmt.Printf("Removed %s\n", e.Path)
+		case manifest.Edited:
+			edited++
+			files = append(files, e)
+			fmt.Printf("WARN Refusing to remove %s because it was edited since it was generated\n", e.Path)
+		}
+	}
+
+	mf.Files = files
+	err = mf.Save()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d generated file(s)\n", removed)
+	if failed > 0 {
+		return errors.Errorf("%d file(s) could not be removed", failed)
+	}
+	if edited > 0 {
+		return errors.Errorf("%d edited file(s) were left in place", edited)
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/innovation-upstream/codema/internal/convert"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	convertToRaw   string
+	convertInPath  string
+	convertOutPath string
+	convertForce   bool
+)
+
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert a config between YAML and Starlark",
+	Long: `Convert codema.yaml to codema.star or codema.star to codema.yaml.
+The converted file is loaded again and must resolve to the same config as the original before it is written.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := convertConfig()
+		if err != nil {
+			fmt.Printf("Error converting config: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	convertCmd.Flags().StringVar(&convertToRaw, "to", "starlark", "Format to convert to. One of: yaml, starlark")
+	convertCmd.Flags().StringVarP(&convertInPath, "in", "i", "", "Config to convert. Defaults to codema.yaml or codema.star depending on --to")
+	convertCmd.Flags().StringVarP(&convertOutPath, "out", "o", "", "File to write. Defaults to codema.star or codema.yaml depending on --to")
+	convertCmd.Flags().BoolVarP(&convertForce, "force", "f", false, "Overwrite the output file if it exists")
+}
+
+func newConfigLoaderForPath(format, path string) (config.ConfigLoader, error) {
+	switch format {
+	case "yaml":
+		return config.NewYAMLConfigLoaderFromPath(path), nil
+	case "starlark":
+		return config.NewStarlarkConfigLoaderFromPath(path), nil
+	default:
+		return nil, errors.Errorf("unknown config format: %s", format)
+	}
+}
+
+func convertConfig() error {
+	var fromFormat, defaultIn, defaultOut string
+	var emit func(*config.Config) ([]byte, error)
+	switch convertToRaw {
+	case "starlark":
+		fromFormat, defaultIn, defaultOut = "yaml", "codema.yaml", "codema.star"
+		emit = convert.ToStarlark
+	case "yaml":
+		fromFormat, defaultIn, defaultOut = "starlark", "codema.star", "codema.yaml"
+		emit = convert.ToYAML
+	default:
+		return errors.Errorf("unknown config format: %s", convertToRaw)
+	}
+
+	inPath := convertInPath
+	if inPath == "" {
+		inPath = defaultIn
+	}
+	outPath := convertOutPath
+	if outPath == "" {
+		outPath = defaultOut
+	}
+
+	if _, err := os.Stat(outPath); err == nil && !convertForce {
+		return errors.Errorf("%s already exists, use --force to overwrite it", outPath)
+	}
+
+	srcLoader, err := newConfigLoaderForPath(fromFormat, inPath)
+	if err != nil {
+		return err
+	}
+	cfg, err := srcLoader.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to load "+inPath)
+	}
+
+	content, err := emit(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Write next to the destination so relative paths resolve the same way,
+	// and only move the file into place once the round trip succeeded
+	tmp, err := os.CreateTemp(filepath.Dir(outPath), ".codema-convert-*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = tmp.Write(content)
+	closeErr := tmp.Close()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if closeErr != nil {
+		return errors.WithStack(closeErr)
+	}
+
+	dstLoader, err := newConfigLoaderForPath(convertToRaw, tmpPath)
+	if err != nil {
+		return err
+	}
+	roundTrip, err := dstLoader.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to load converted config")
+	}
+
+	err = convert.CompareConfigs(cfg, roundTrip)
+	if err != nil {
+		return errors.Wrap(err, "converted config does not match "+inPath)
+	}
+
+	err = os.Rename(tmpPath, outPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	os.Chmod(outPath, 0644)
+
+	fmt.Printf("Converted %s to %s\n", inPath, outPath)
+	return nil
+}
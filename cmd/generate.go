@@ -4,25 +4,57 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/innovation-upstream/codema/internal/manifest"
 	"github.com/innovation-upstream/codema/internal/plugin/goimports"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	"github.com/innovation-upstream/codema/internal/model"
 	"github.com/innovation-upstream/codema/internal/plugin"
 	"github.com/innovation-upstream/codema/internal/tag"
 	"github.com/innovation-upstream/codema/internal/target"
+	targetrenderer "github.com/innovation-upstream/codema/internal/target-renderer"
 )
 
 var (
-	targetsRaw      string
-	configFormatRaw string
+	targetsRaw        string
+	configFormatRaw   string
+	generateJobs      int
+	generateKeepGoing bool
+	generateDryRun    bool
+	generateCheck     bool
+	generateNoCache   bool
+	generatePrune     bool
+)
+
+const (
+	renderCachePath = ".codema/cache.json"
+	mergeBasePath   = ".codema/base"
+	manifestPath    = "codema.manifest.json"
 )
 
 type (
 	TargetFlags []string
+
+	targetPlan struct {
+		target config.Target
+		apis   []targetApiPlan
+		// apiCount is the number of apis rendered, which for project targets
+		// are all apis of the config
+		apiCount int
+	}
+
+	// targetApiPlan records how many of the planned units belong to a target
+	// api, so results can be reported per api in config order
+	targetApiPlan struct {
+		api       config.TargetApi
+		unitCount int
+	}
 )
 
 func (t TargetFlags) Includes(s string) bool {
@@ -61,120 +93,387 @@ var generateCmd = &cobra.Command{
 		targetsToRender := TargetFlags(strings.Split(targetsRaw, ","))
 		targetsToRender = targetsToRender.TrimSpace()
 
-		renderedTargets := TargetFlags{}
 		logRenderTargets := strings.Join([]string(targetsToRender), ", ")
 		if isAllTargets {
 			logRenderTargets = "ALL"
 		}
 
-		isYAML := configFormatRaw == "yaml"
-		var cfgLoader config.ConfigLoader
+		session, err := loadGenerateSession(newConfigLoader(configFormatRaw))
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+		cfg := session.cfg
 
-		if isYAML {
-			cfgLoader = config.NewYAMLConfigLoader()
-		} else {
-			cfgLoader = config.NewStarlarkConfigLoader()
+		plans, units, renderedTargets, err := session.plan(targetsToRender, isAllTargets)
+		if err != nil {
+			fmt.Printf("%+v", err)
+			os.Exit(1)
 		}
 
-		cfg, err := cfgLoader.GetConfig()
+		slog.Info("Will render target(s):", slog.String("targets", logRenderTargets), slog.Int("jobs", generateJobs))
+		workDir, err := os.Getwd()
 		if err != nil {
 			panic(err)
 		}
 
-		templatesDir := config.ExpandTemplatePath(cfg.TemplateDir)
+		var output generateOutput = &diskOutput{workDir: workDir, prune: generatePrune, mergeBases: session.mergeBases}
+		if generateDryRun {
+			output = newDryRunOutput(workDir)
+		} else if generateCheck {
+			output = newCheckOutput(workDir)
+		}
 
-		apis := make(map[string]config.ApiDefinition)
+		// The cache is consulted in every mode, but only updated when files
+		// are written
+		var renderCache *target.RenderCache
+		if !generateNoCache {
+			renderCache, err = target.LoadRenderCache(renderCachePath)
+			if err != nil {
+				fmt.Printf("Error loading render cache: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		isWriting := !generateDryRun && !generateCheck
 
-		tagReg := tag.NewTagRegistery(nil)
-		modelReg := model.NewModelRegistery(nil)
+		mf := session.manifest
+		var produced []manifest.Entry
+		retainedPaths := make(map[string]bool)
 
-		for _, a := range cfg.Apis {
-			apis[a.Label] = a
+		pool := target.NewRenderPool(units, generateJobs, renderCache)
 
-			for _, ms := range a.Microservices {
-				modelReg.RegisterModel(ms.PrimaryModel)
+		var totalFileCount int
+		var renderErrs []error
+		for _, plan := range plans {
+			t := plan.target
 
-				for _, field := range ms.PrimaryModel.Fields {
-					for _, tag := range field.Tags {
-						tagReg.RegisterTag(tag)
-					}
+			var targetFileCount int
+			for _, ap := range plan.apis {
+				ta := ap.api
+				// Project targets render the whole config rather than an api
+				apiAttr := slog.String("api", ta.Label)
+				unitDesc := "api " + ta.Label
+				if t.Scope == config.TargetScopeProject {
+					apiAttr = slog.String("scope", string(config.TargetScopeProject))
+					unitDesc = "project"
 				}
+				slog.Info("Rendering target for api", slog.String("target", t.Label), apiAttr)
+
+				var fileCount int
+				for i := 0; i < ap.unitCount; i++ {
+					res := pool.Next()
+					err := res.Err
+					if err == nil {
+						err = output.Emit(res)
+					}
+					if err != nil {
+						retainedPaths[res.Unit.Path] = true
+						err = errors.Wrapf(err, "target %s, %s, %s", t.Label, unitDesc, res.Unit.Path)
+						if !generateKeepGoing {
+							pool.Stop()
+							fmt.Printf("Error rendering: %v\n", err)
+							if isWriting {
+								fmt.Println("No files were written")
+							}
+							os.Exit(1)
+						}
+						renderErrs = append(renderErrs, err)
+						continue
+					}
 
-				for _, model := range ms.SecondaryModels {
-					modelReg.RegisterModel(model)
+					var msLabel string
+					if res.Unit.Microservice != nil {
+						msLabel = res.Unit.Microservice.Label
+					}
 
-					for _, field := range model.Fields {
-						for _, tag := range field.Tags {
-							tagReg.RegisterTag(tag)
+					// Kept files are not what codema generated, so they are
+					// neither cached nor recorded as generated
+					var kept bool
+					for _, f := range res.Files {
+						fileCount++
+						if f.Kept {
+							retainedPaths[f.Path] = true
+							kept = true
+							continue
 						}
+						produced = append(produced, mf.NewEntry(f.Path, t.Label, ta.Label, msLabel, f.Content))
+					}
+
+					if renderCache != nil && isWriting && res.InputHash != "" && !kept {
+						renderCache.Store(res.Unit.Path, res.InputHash, res.Files)
 					}
 				}
+
+				targetFileCount += fileCount
+				totalFileCount += fileCount
+				slog.Info("Rendered target for api", slog.String("target", t.Label), apiAttr, slog.Int("file_count", fileCount))
 			}
+
+			slog.Info("Rendered target", slog.String("target", t.Label), slog.Int("api_count", plan.apiCount), slog.Int("file_count", targetFileCount))
 		}
 
-		pluginRegistry := plugin.NewPluginRegistry()
+		if !isAllTargets && len(renderedTargets) != len(targetsToRender) {
+			for _, tr := range targetsToRender {
+				if !renderedTargets.Includes(tr) {
+					fmt.Printf("WARN Skipped target: %s because it was not defined\n", tr)
+				}
+			}
+		}
 
-		for _, t := range cfg.Targets {
-			err := loadPluginsForTarget(pluginRegistry, t)
-			if err != nil {
-				slog.Error("Failed to load plugins for target " + t.Label + " " + err.Error())
-				os.Exit(1)
+		slog.Info("Rendered files", slog.Int("file_count", totalFileCount))
+
+		// Files are only written when every unit rendered, so a broken
+		// template never leaves the tree half generated
+		if len(renderErrs) > 0 && isWriting {
+			for _, err := range renderErrs {
+				fmt.Printf("Error rendering: %v\n", err)
 			}
+			fmt.Println("No files were written")
+			os.Exit(1)
 		}
 
-		slog.Info("Will render target(s):", slog.String("targets", logRenderTargets))
-		var totalFileCount int
+		renderedTargetSet := make(map[string]bool)
+		for _, plan := range plans {
+			renderedTargetSet[plan.target.Label] = true
+		}
+		definedTargetSet := make(map[string]bool)
 		for _, t := range cfg.Targets {
-			if !isAllTargets {
-				enabledByFlag := targetsToRender.Includes(t.Label)
-				if !enabledByFlag {
-					continue
-				}
+			definedTargetSet[t.Label] = true
+		}
+		err = updateManifest(mf, produced, retainedPaths, renderedTargetSet, definedTargetSet, output)
+		if err != nil {
+			fmt.Printf("Error updating manifest: %v\n", err)
+			os.Exit(1)
+		}
 
-				renderedTargets = append(renderedTargets, t.Label)
-			}
+		if renderCache != nil {
+			hits, misses := renderCache.Stats()
+			slog.Info("Render cache", slog.Int("hits", hits), slog.Int("misses", misses))
+		}
+
+		if err := output.Finish(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
 
-			ctrl := target.TargetProcessorController{
-				ApiRegistry:    apis,
-				ParentTarget:   t,
-				TemplatesDir:   templatesDir,
-				PluginRegistry: pluginRegistry,
-				TagRegistry:    tagReg,
-				ModelRegistry:  modelReg,
+		// The manifest and cache describe the files on disk, so they are only
+		// saved once the files were written
+		if isWriting {
+			if err := mf.Save(); err != nil {
+				fmt.Printf("Error saving manifest: %v\n", err)
+				os.Exit(1)
 			}
 
-			var targetFileCount int
-			for _, ta := range t.Apis {
-				slog.Info("Rendering target for api", slog.String("target", t.Label), slog.String("api", ta.Label))
-				fileCount, err := ctrl.ProcessTargetApi(ta)
-				if err != nil {
-					fmt.Printf("%+v", err)
+			if renderCache != nil {
+				if err := renderCache.Save(); err != nil {
+					fmt.Printf("Error saving render cache: %v\n", err)
 					os.Exit(1)
 				}
-
-				targetFileCount += fileCount
-				totalFileCount += fileCount
-				slog.Info("Rendered target for api", slog.String("target", t.Label), slog.String("api", ta.Label), slog.Int("file_count", fileCount))
 			}
-
-			slog.Info("Rendered target", slog.String("target", t.Label), slog.Int("api_count", len(t.Apis)), slog.Int("file_count", targetFileCount))
 		}
 
-		if !isAllTargets && len(renderedTargets) != len(targetsToRender) {
-			for _, tr := range targetsToRender {
-				if !renderedTargets.Includes(tr) {
-					fmt.Printf("WARN Skipped target: %s because it was not defined\n", tr)
-				}
+		if len(renderErrs) > 0 {
+			for _, err := range renderErrs {
+				fmt.Printf("Error rendering: %v\n", err)
 			}
+			os.Exit(1)
 		}
-
-		slog.Info("Rendered files", slog.Int("file_count", totalFileCount))
 	},
 }
 
 func init() {
 	generateCmd.Flags().StringVarP(&targetsRaw, "targets", "t", "*", "Targets to render")
 	generateCmd.Flags().StringVarP(&configFormatRaw, "config", "c", "yaml", "Config format. One of: yaml, starlark")
+	generateCmd.Flags().IntVarP(&generateJobs, "jobs", "j", runtime.NumCPU(), "Number of units to render concurrently")
+	generateCmd.Flags().BoolVar(&generateDryRun, "dry-run", false, "Render into memory and print a diff against the files on disk instead of writing them")
+	generateCmd.Flags().BoolVar(&generateCheck, "check", false, "Render into memory and exit non-zero listing every output that is stale or missing on disk")
+	generateCmd.MarkFlagsMutuallyExclusive("dry-run", "check")
+	generateCmd.Flags().BoolVar(&generateNoCache, "no-cache", false, "Render every unit, ignoring the render cache")
+	generateCmd.Flags().BoolVar(&generatePrune, "prune", false, "Delete files generated by a previous run that are no longer produced, unless they were edited")
+	generateCmd.Flags().BoolVar(&generateKeepGoing, "keep-going", false, "Keep rendering after a failure and report every failure at the end")
+}
+
+// generateSession holds the loaded config and the registries built from it.
+type generateSession struct {
+	cfg            *config.Config
+	templatesDir   string
+	apis           map[string]config.ApiDefinition
+	tagReg         tag.TagRegistry
+	modelReg       model.ModelRegistry
+	pluginRegistry *plugin.PluginRegistry
+	mergeBases     *target.MergeBases
+	manifest       *manifest.Manifest
+	// configFiles are the files the config was read from
+	configFiles []string
+}
+
+func newConfigLoader(format string) config.ConfigLoader {
+	if format == "yaml" {
+		return config.NewYAMLConfigLoader()
+	}
+
+	return config.NewStarlarkConfigLoader()
+}
+
+func loadGenerateSession(cfgLoader config.ConfigLoader) (*generateSession, error) {
+	cfg, err := cfgLoader.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Every path is absolute, so a file has a single name however it was
+	// configured, and plugins running in another directory still find it
+	templatesDir, err := absTemplatesDir(config.ExpandTemplatePath(cfg.TemplateDir))
+	if err != nil {
+		return nil, err
+	}
+
+	apis := make(map[string]config.ApiDefinition)
+
+	tagReg := tag.NewTagRegistery(nil)
+	modelReg := model.NewModelRegistery(nil)
+
+	for _, a := range cfg.Apis {
+		apis[a.Label] = a
+
+		for _, ms := range a.Microservices {
+			modelReg.RegisterModel(ms.PrimaryModel)
+
+			for _, field := range ms.PrimaryModel.Fields {
+				for _, tag := range field.Tags {
+					tagReg.RegisterTag(tag)
+				}
+			}
+
+			for _, model := range ms.SecondaryModels {
+				modelReg.RegisterModel(model)
+
+				for _, field := range model.Fields {
+					for _, tag := range field.Tags {
+						tagReg.RegisterTag(tag)
+					}
+				}
+			}
+		}
+	}
+
+	pluginRegistry := plugin.NewPluginRegistry()
+
+	for _, t := range cfg.Targets {
+		err := loadPluginsForTarget(pluginRegistry, t)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load plugins for target %s", t.Label)
+		}
+	}
+
+	mergeBases, err := target.NewMergeBases(mergeBasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	mf, err := manifest.Load(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &generateSession{
+		cfg:            cfg,
+		templatesDir:   templatesDir,
+		apis:           apis,
+		tagReg:         tagReg,
+		modelReg:       modelReg,
+		pluginRegistry: pluginRegistry,
+		mergeBases:     mergeBases,
+		manifest:       mf,
+		configFiles:    cfgLoader.SourceFiles(),
+	}, nil
+}
+
+// configFile returns the entry config file relative to the working
+// directory.
+func (s *generateSession) configFile() string {
+	if len(s.configFiles) == 0 {
+		return ""
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		return s.configFiles[0]
+	}
+
+	return displayPath(workDir, s.configFiles[0])
+}
+
+// plan plans every unit of the targets to render up front, so they can be
+// rendered concurrently and reported in config order.
+func (s *generateSession) plan(targetsToRender TargetFlags, isAllTargets bool) ([]targetPlan, []target.RenderUnit, TargetFlags, error) {
+	// Partials are read while planning too, so watch picks up their changes
+	var partialsDir string
+	var partials targetrenderer.Partials
+	if s.cfg.PartialsDir != "" {
+		partialsDir = s.templatesDir + s.cfg.PartialsDir
+		var err error
+		partials, err = targetrenderer.LoadPartials(partialsDir)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	renderedTargets := TargetFlags{}
+	var plans []targetPlan
+	var units []target.RenderUnit
+	for _, t := range s.cfg.Targets {
+		if !isAllTargets {
+			enabledByFlag := targetsToRender.Includes(t.Label)
+			if !enabledByFlag {
+				continue
+			}
+
+			renderedTargets = append(renderedTargets, t.Label)
+		}
+
+		ctrl := &target.TargetProcessorController{
+			ApiRegistry:    s.apis,
+			ParentTarget:   t,
+			TemplatesDir:   s.templatesDir,
+			PluginRegistry: s.pluginRegistry,
+			TagRegistry:    s.tagReg,
+			ModelRegistry:  s.modelReg,
+			MergeBases:     s.mergeBases,
+			WrittenFiles:   s.manifest,
+			ConfigFile:     s.configFile(),
+			PartialsDir:    partialsDir,
+			Partials:       partials,
+			TemplateFuncs:  s.cfg.TemplateFuncs,
+		}
+
+		plan := targetPlan{target: t}
+		if t.Scope == config.TargetScopeProject {
+			projectUnits, err := ctrl.PlanProject(s.cfg)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			plan.apis = append(plan.apis, targetApiPlan{api: target.ProjectTargetApi(t), unitCount: len(projectUnits)})
+			plan.apiCount = len(s.cfg.Apis)
+			units = append(units, projectUnits...)
+			plans = append(plans, plan)
+			continue
+		}
+		for _, ta := range t.Apis {
+			apiUnits, err := ctrl.PlanTargetApi(ta)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			plan.apis = append(plan.apis, targetApiPlan{api: ta, unitCount: len(apiUnits)})
+			units = append(units, apiUnits...)
+		}
+		plan.apiCount = len(plan.apis)
+		plans = append(plans, plan)
+	}
+
+	return plans, units, renderedTargets, nil
 }
 
 func loadPluginsForTarget(registry *plugin.PluginRegistry, t config.Target) error {
@@ -191,3 +490,17 @@ func loadPluginsForTarget(registry *plugin.PluginRegistry, t config.Target) erro
 	}
 	return nil
 }
+
+// absTemplatesDir makes the templates dir absolute. Template paths are
+// appended to it as is, so a trailing separator is kept.
+func absTemplatesDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if (dir == "" || strings.HasSuffix(dir, "/")) && !strings.HasSuffix(abs, "/") {
+		abs += "/"
+	}
+
+	return abs, nil
+}
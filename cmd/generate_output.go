@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/innovation-upstream/codema/internal/diff"
+	"github.com/innovation-upstream/codema/internal/manifest"
+	"github.com/innovation-upstream/codema/internal/target"
+	"github.com/pkg/errors"
+)
+
+type (
+	// generateOutput receives the rendered files of generate in unit order,
+	// followed by the files of the manifest that are no longer generated.
+	// Orphaned reports whether the orphan stays in the manifest.
+	generateOutput interface {
+		Emit(res target.RenderResult) error
+		Orphaned(mf *manifest.Manifest, e manifest.Entry) (bool, error)
+		Finish() error
+	}
+
+	// diskOutput writes all files in a single transaction when generate
+	// finishes, then deletes orphans when prune is set.
+	diskOutput struct {
+		workDir string
+		prune   bool
+		// mergeBases of deleted orphans are deleted along with them
+		mergeBases *target.MergeBases
+		tx         target.WriteTransaction
+		orphans    []manifest.Entry
+		mf         *manifest.Manifest
+		conflicts  []string
+	}
+
+	// dryRunOutput prints a diff of every file that would change instead of
+	// writing it.
+	dryRunOutput struct {
+		// workDir is the directory paths are displayed relative to
+		workDir string
+		counts  map[target.FileStatus]int
+		orphans int
+	}
+
+	// checkOutput compares every file to the file on disk and fails when any
+	// is stale or missing, without writing anything.
+	checkOutput struct {
+		workDir string
+		stale   []string
+	}
+)
+
+func (o *diskOutput) Emit(res target.RenderResult) error {
+	// Cached files are already on disk as rendered, rewriting them would only
+	// bump their mtime. Kept files are left as they are
+	if res.Cached {
+		return nil
+	}
+
+	for _, f := range res.Files {
+		if f.Kept {
+			if f.MergeBase != nil {
+				o.tx.Add(*f.MergeBase)
+			}
+			continue
+		}
+
+		o.tx.Add(f)
+		if f.Conflicts > 0 {
+			o.conflicts = append(o.conflicts, f.Path)
+		}
+	}
+
+	return nil
+}
+
+func (o *diskOutput) Orphaned(mf *manifest.Manifest, e manifest.Entry) (bool, error) {
+	if !o.prune {
+		slog.Warn("Orphaned generated file, run with --prune to delete it", slog.String("path", e.Path), slog.String("target", e.Target))
+		return true, nil
+	}
+
+	// Orphans are removed once the new files are written
+	o.mf = mf
+	o.orphans = append(o.orphans, e)
+
+	return false, nil
+}
+
+func (o *diskOutput) Finish() error {
+	err := o.tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "no files were written")
+	}
+	slog.Info("Wrote files", slog.Int("file_count", o.tx.Len()))
+
+	if len(o.conflicts) > 0 {
+		fmt.Printf("Merge conflicts in %d file(s), resolve the conflict markers:\n", len(o.conflicts))
+		for _, path := range o.conflicts {
+			fmt.Printf("  %s\n", displayPath(o.workDir, path))
+		}
+	}
+
+	for _, e := range o.orphans {
+		status, err := o.mf.Remove(e)
+		if err != nil {
+			slog.Warn("Failed to remove orphaned file, it is no longer tracked", slog.String("path", e.Path), slog.String("error", err.Error()))
+			continue
+		}
+
+		if status == manifest.Removed || status == manifest.Missing {
+			if err := o.mergeBases.Remove(o.mf.AbsPath(e)); err != nil {
+				slog.Warn("Failed to remove the merge base of an orphaned file", slog.String("path", e.Path), slog.String("error", err.Error()))
+			}
+		}
+
+		switch status {
+		case manifest.Removed:
+			slog.Info("Removed orphaned file", slog.String("path", e.Path), slog.String("target", e.Target))
+		case manifest.Edited:
+			slog.Warn("Kept orphaned file because it was edited, it is no longer tracked", slog.String("path", e.Path), slog.String("target", e.Target))
+		}
+	}
+
+	return nil
+}
+
+func newDryRunOutput(workDir string) *dryRunOutput {
+	return &dryRunOutput{
+		workDir: workDir,
+		counts:  make(map[target.FileStatus]int),
+	}
+}
+
+func (o *dryRunOutput) Emit(res target.RenderResult) error {
+	for _, f := range res.Files {
+		status, current, err := target.CompareGeneratedFile(f)
+		if err != nil {
+			return err
+		}
+		o.counts[status]++
+
+		if status == target.FileUnchanged {
+			continue
+		}
+
+		path := displayPath(o.workDir, f.Path)
+		oldName := "a/" + path
+		if status == target.FileNew {
+			oldName = "/dev/null"
+		}
+		fmt.Print(diff.Unified(oldName, "b/"+path, current, f.Content, 3))
+	}
+
+	return nil
+}
+
+func (o *dryRunOutput) Orphaned(mf *manifest.Manifest, e manifest.Entry) (bool, error) {
+	path := mf.AbsPath(e)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	o.orphans++
+	fmt.Printf("orphaned: %s\n", displayPath(o.workDir, path))
+
+	return true, nil
+}
+
+func (o *dryRunOutput) Finish() error {
+	fmt.Printf(
+		"Dry run: %d new, %d changed, %d unchanged, %d orphaned file(s)\n",
+		o.counts[target.FileNew],
+		o.counts[target.FileChanged],
+		o.counts[target.FileUnchanged],
+		o.orphans,
+	)
+
+	return nil
+}
+
+func newCheckOutput(workDir string) *checkOutput {
+	return &checkOutput{
+		workDir: workDir,
+	}
+}
+
+func (o *checkOutput) Emit(res target.RenderResult) error {
+	for _, f := range res.Files {
+		status, _, err := target.CompareGeneratedFile(f)
+		if err != nil {
+			return err
+		}
+
+		switch status {
+		case target.FileChanged:
+			o.stale = append(o.stale, "stale:    "+displayPath(o.workDir, f.Path))
+		case target.FileNew:
+			o.stale = append(o.stale, "missing:  "+displayPath(o.workDir, f.Path))
+		}
+	}
+
+	return nil
+}
+
+func (o *checkOutput) Orphaned(mf *manifest.Manifest, e manifest.Entry) (bool, error) {
+	path := mf.AbsPath(e)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	o.stale = append(o.stale, "orphaned: "+displayPath(o.workDir, path))
+
+	return true, nil
+}
+
+func (o *checkOutput) Finish() error {
+	if len(o.stale) == 0 {
+		fmt.Println("All generated files are up to date")
+		return nil
+	}
+
+	for _, s := range o.stale {
+		fmt.Println(s)
+	}
+
+	return errors.Errorf("%d generated file(s) are stale, missing or orphaned, run codema generate", len(o.stale))
+}
+
+// displayPath returns path relative to the working directory when it is
+// inside it.
+func displayPath(workDir, path string) string {
+	rel, err := filepath.Rel(workDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+
+	return rel
+}
+
+// updateManifest replaces the entries of the rendered targets with the files
+// produced by this run. Previous entries of rendered targets, or of targets
+// that were removed from the config, that were not produced again are
+// orphans. Entries of units that failed to render, or whose files were kept
+// by their write policy, are retained as they were.
+func updateManifest(
+	mf *manifest.Manifest,
+	produced []manifest.Entry,
+	retainedPaths map[string]bool,
+	renderedTargets map[string]bool,
+	definedTargets map[string]bool,
+	output generateOutput,
+) error {
+	producedPaths := make(map[string]bool, len(produced))
+	for _, e := range produced {
+		producedPaths[e.Path] = true
+	}
+
+	files := append([]manifest.Entry(nil), produced...)
+	for _, e := range mf.Files {
+		if producedPaths[e.Path] {
+			continue
+		}
+		if retainedPaths[mf.AbsPath(e)] || (!renderedTargets[e.Target] && definedTargets[e.Target]) {
+			files = append(files, e)
+			continue
+		}
+
+		keep, err := output.Orphaned(mf, e)
+		if err != nil {
+			return err
+		}
+		if keep {
+			files = append(files, e)
+		}
+	}
+	mf.Files = files
+
+	return nil
+}
+
+// recordProduced adds the produced files to the manifest without looking for
+// orphans, for runs that only render some of the units.
+func recordProduced(mf *manifest.Manifest, produced []manifest.Entry) error {
+	producedPaths := make(map[string]bool, len(produced))
+	for _, e := range produced {
+		producedPaths[e.Path] = true
+	}
+
+	files := append([]manifest.Entry(nil), produced...)
+	for _, e := range mf.Files {
+		if !producedPaths[e.Path] {
+			files = append(files, e)
+		}
+	}
+	mf.Files = files
+
+	return mf.Save()
+}
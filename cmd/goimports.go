@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/innovation-upstream/codema/internal/plugin/goimports"
+	"github.com/spf13/cobra"
+)
+
+// goimportsFileCmd runs goimports on stdin for the GoImports plugin, in the
+// working directory of the generated file.
+var goimportsFileCmd = &cobra.Command{
+	Use:    goimports.Command + " <filename>",
+	Hidden: true,
+	Args:   cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		content, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			content, err = goimports.Process(args[0], content)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
+		os.Stdout.Write(content)
+	},
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/innovation-upstream/codema/internal/importer"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var importOutPath string
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import models from existing schemas",
+	Long:  `Import models and enums from existing schemas and print them as Starlark definitions.`,
+}
+
+var importProtoCmd = &cobra.Command{
+	Use:   "proto [files...]",
+	Short: "Import models from protobuf files",
+	Long:  `Import messages and enums from proto3 files as codema models and enums.`,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runImport(args, importer.ImportProto)
+	},
+}
+
+var importGraphQLCmd = &cobra.Command{
+	Use:   "graphql [files...]",
+	Short: "Import models from a GraphQL SDL schema",
+	Long:  `Import object types, input types and enums from GraphQL SDL files as codema models and enums.`,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runImport(args, importer.ImportGraphQL)
+	},
+}
+
+var importOpenAPICmd = &cobra.Command{
+	Use:   "openapi [files...]",
+	Short: "Import models from OpenAPI or JSON Schema documents",
+	Long:  `Import components.schemas of OpenAPI documents, or definitions of JSON Schema documents, as codema models and enums.`,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runImport(args, importer.ImportOpenAPI)
+	},
+}
+
+var importGoCmd = &cobra.Command{
+	Use:   "go [packages...]",
+	Short: "Import models from Go structs",
+	Long:  `Import the exported structs of Go package directories or files as codema models. Named types with constants are imported as enums.`,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runImport(args, importer.ImportGo)
+	},
+}
+
+var importSQLCmd = &cobra.Command{
+	Use:   "sql [files...]",
+	Short: "Import models from SQL DDL",
+	Long:  `Import CREATE TABLE and CREATE TYPE ... AS ENUM statements of Postgres DDL files as codema models and enums.`,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runImport(args, importer.ImportSQL)
+	},
+}
+
+func init() {
+	importCmd.PersistentFlags().StringVarP(&importOutPath, "out", "o", "", "File to write the Starlark definitions to. Defaults to stdout")
+	importCmd.AddCommand(importProtoCmd)
+	importCmd.AddCommand(importGraphQLCmd)
+	importCmd.AddCommand(importOpenAPICmd)
+	importCmd.AddCommand(importGoCmd)
+	importCmd.AddCommand(importSQLCmd)
+}
+
+func runImport(args []string, importFn func([]string) (*importer.Result, error)) {
+	err := importSchemas(args, importFn)
+	if err != nil {
+		fmt.Printf("Error importing: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func importSchemas(args []string, importFn func([]string) (*importer.Result, error)) error {
+	paths, err := expandImportPaths(args)
+	if err != nil {
+		return err
+	}
+
+	result, err := importFn(paths)
+	if err != nil {
+		return err
+	}
+
+	content, err := result.ToStarlark(paths)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range result.Report {
+		fmt.Fprintf(os.Stderr, "WARN %s\n", r)
+	}
+
+	if importOutPath == "" {
+		_, err = os.Stdout.Write(content)
+		return errors.WithStack(err)
+	}
+
+	err = os.WriteFile(importOutPath, content, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d model(s) and %d enum(s) into %s\n", len(result.Models), len(result.Enums), importOutPath)
+	return nil
+}
+
+// expandImportPaths expands glob patterns the shell left alone, e.g. when
+// they were quoted.
+func expandImportPaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if len(matches) == 0 {
+			return nil, errors.Errorf("no files match %s", arg)
+		}
+		paths = append(paths, matches...)
+	}
+
+	return paths, nil
+}
@@ -25,4 +25,9 @@ func init() {
 	rootCmd.AddCommand(pullCmd)
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(publishCmd)
+	rootCmd.AddCommand(convertCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(cleanCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(goimportsFileCmd)
 }
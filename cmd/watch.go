@@ -0,0 +1,345 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/innovation-upstream/codema/internal/manifest"
+	"github.com/innovation-upstream/codema/internal/target"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchTargetsRaw      string
+	watchConfigFormatRaw string
+	watchJobs            int
+	watchInterval        time.Duration
+)
+
+type (
+	// watcher polls the config, templates and snippets of a project and
+	// re-renders the units affected by a change.
+	watcher struct {
+		targetsToRender TargetFlags
+		isAllTargets    bool
+		workDir         string
+		session         *generateSession
+		configFiles     []string
+		units           []target.RenderUnit
+		snapshot        map[string]fileStamp
+		cache           *target.RenderCache
+	}
+
+	fileStamp struct {
+		modTime time.Time
+		size    int64
+	}
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Regenerate code when the config, templates or snippets change",
+	Long:  `Watch the config files, including loaded Starlark files, target templates, snippets, imports files and hook directories, and re-render the targets and microservices affected by every change.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := watch()
+		if err != nil {
+			fmt.Printf("Error watching: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	watchCmd.Flags().StringVarP(&watchTargetsRaw, "targets", "t", "*", "Targets to render")
+	watchCmd.Flags().StringVarP(&watchConfigFormatRaw, "config", "c", "yaml", "Config format. One of: yaml, starlark")
+	watchCmd.Flags().IntVarP(&watchJobs, "jobs", "j", runtime.NumCPU(), "Number of units to render concurrently")
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 500*time.Millisecond, "How often to poll for changes")
+}
+
+func watch() error {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	cache, err := target.LoadRenderCache(renderCachePath)
+	if err != nil {
+		return err
+	}
+
+	w := &watcher{
+		targetsToRender: TargetFlags(strings.Split(watchTargetsRaw, ",")).TrimSpace(),
+		isAllTargets:    watchTargetsRaw == "*",
+		workDir:         workDir,
+		cache:           cache,
+	}
+
+	w.update(nil)
+	fmt.Printf("Watching %d file(s) for changes\n", len(w.snapshot))
+
+	for {
+		time.Sleep(watchInterval)
+
+		changed := diffSnapshots(w.snapshot, takeSnapshot(w.watchedPaths()))
+		if len(changed) == 0 {
+			continue
+		}
+
+		display := make([]string, len(changed))
+		for i, c := range changed {
+			display[i] = displayPath(w.workDir, c)
+		}
+		fmt.Printf("[%s] Changed: %s\n", time.Now().Format("15:04:05"), strings.Join(display, ", "))
+
+		w.update(changed)
+	}
+}
+
+// update reloads what the changed files affect and renders the affected
+// units. A nil changed list loads and renders everything.
+func (w *watcher) update(changed []string) {
+	configChanged := w.session == nil
+	for _, c := range changed {
+		for _, f := range w.configFiles {
+			if sameFile(c, f) {
+				configChanged = true
+			}
+		}
+	}
+
+	if configChanged {
+		loader := newConfigLoader(watchConfigFormatRaw)
+		session, err := loadGenerateSession(loader)
+		w.configFiles = loader.SourceFiles()
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			w.snapshot = takeSnapshot(w.watchedPaths())
+			return
+		}
+		w.session = session
+	}
+
+	// Templates are read while planning, so every change plans again
+	_, units, _, err := w.session.plan(w.targetsToRender, w.isAllTargets)
+	if err != nil {
+		fmt.Printf("Error planning: %v\n", err)
+		w.snapshot = takeSnapshot(w.watchedPaths())
+		return
+	}
+	w.units = units
+
+	// Snapshot before rendering, so changes made while rendering are picked
+	// up by the next poll
+	w.snapshot = takeSnapshot(w.watchedPaths())
+
+	affected := units
+	if !configChanged {
+		affected = nil
+		for _, u := range units {
+			if dependsOnAny(u, changed) {
+				affected = append(affected, u)
+			}
+		}
+	}
+
+	w.render(affected)
+}
+
+func (w *watcher) render(units []target.RenderUnit) {
+	start := time.Now()
+	pool := target.NewRenderPool(units, watchJobs, w.cache)
+
+	var tx target.WriteTransaction
+	var rendered []target.RenderResult
+	var written []string
+	var unchanged, failed int
+	var produced []manifest.Entry
+	for range units {
+		res := pool.Next()
+		err := res.Err
+		var staged []string
+		if err == nil && !res.Cached {
+			staged, err = stageChanged(&tx, res.Files)
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("  error: target %s, api %s, %s: %v\n", res.Unit.Ctrl.ParentTarget.Label, res.Unit.TargetApi.Label, displayPath(w.workDir, res.Unit.Path), err)
+			continue
+		}
+		written = append(written, staged...)
+		unchanged += len(res.Files) - len(staged)
+
+		var msLabel string
+		if res.Unit.Microservice != nil {
+			msLabel = res.Unit.Microservice.Label
+		}
+		var kept bool
+		for _, f := range res.Files {
+			if f.Kept {
+				kept = true
+				continue
+			}
+			if f.Conflicts > 0 {
+				fmt.Printf("  conflict: %s has %d merge conflict(s)\n", displayPath(w.workDir, f.Path), f.Conflicts)
+			}
+			produced = append(produced, w.session.manifest.NewEntry(f.Path, res.Unit.Ctrl.ParentTarget.Label, res.Unit.TargetApi.Label, msLabel, f.Content))
+		}
+		if !kept {
+			rendered = append(rendered, res)
+		}
+	}
+
+	// Like generate, nothing is written unless every unit rendered
+	if failed > 0 {
+		fmt.Printf(
+			"[%s] Rendered %d unit(s): %d failed, no files were written (%s)\n",
+			time.Now().Format("15:04:05"),
+			len(units),
+			failed,
+			time.Since(start).Round(time.Millisecond),
+		)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Error writing files: %v\n", err)
+		return
+	}
+	for _, path := range written {
+		fmt.Printf("  wrote %s\n", displayPath(w.workDir, path))
+	}
+
+	for _, res := range rendered {
+		if res.InputHash != "" {
+			w.cache.Store(res.Unit.Path, res.InputHash, res.Files)
+		}
+	}
+	if err := w.cache.Save(); err != nil {
+		fmt.Printf("Error saving render cache: %v\n", err)
+	}
+	if err := recordProduced(w.session.manifest, produced); err != nil {
+		fmt.Printf("Error saving manifest: %v\n", err)
+	}
+
+	fmt.Printf(
+		"[%s] Rendered %d unit(s): %d file(s) written, %d unchanged (%s)\n",
+		time.Now().Format("15:04:05"),
+		len(units),
+		len(written),
+		unchanged,
+		time.Since(start).Round(time.Millisecond),
+	)
+}
+
+// stageChanged adds the files that differ from disk to tx and returns their
+// paths. Kept files are left out, but not their merge base.
+func stageChanged(tx *target.WriteTransaction, files []target.GeneratedFile) ([]string, error) {
+	var staged []string
+	for _, f := range files {
+		if f.Kept {
+			if f.MergeBase != nil {
+				tx.Add(*f.MergeBase)
+			}
+			continue
+		}
+
+		status, _, err := target.CompareGeneratedFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if status != target.FileUnchanged {
+			tx.Add(f)
+			staged = append(staged, f.Path)
+		} else if f.MergeBase != nil {
+			// The merge base still moves to the new generated output
+			tx.Add(*f.MergeBase)
+		}
+	}
+
+	return staged, nil
+}
+
+// watchedPaths returns the config files and the dependencies of every unit.
+func (w *watcher) watchedPaths() []string {
+	paths := append([]string(nil), w.configFiles...)
+	for _, u := range w.units {
+		paths = append(paths, u.Dependencies()...)
+	}
+
+	return paths
+}
+
+// takeSnapshot stamps every watched file, walking watched directories.
+// Missing paths are left out, so their creation shows up as a change.
+func takeSnapshot(paths []string) map[string]fileStamp {
+	snapshot := make(map[string]fileStamp)
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+
+		filepath.WalkDir(abs, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			snapshot[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+			return nil
+		})
+	}
+
+	return snapshot
+}
+
+// diffSnapshots returns the files that were added, removed or modified.
+func diffSnapshots(old, new map[string]fileStamp) []string {
+	var changed []string
+	for path, stamp := range new {
+		if prev, ok := old[path]; !ok || prev != stamp {
+			changed = append(changed, path)
+		}
+	}
+	for path := range old {
+		if _, ok := new[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+
+	return changed
+}
+
+// dependsOnAny reports whether a changed file is one of the dependencies of
+// the unit, or inside one of its dependency directories.
+func dependsOnAny(u target.RenderUnit, changed []string) bool {
+	for _, dep := range u.Dependencies() {
+		abs, err := filepath.Abs(dep)
+		if err != nil {
+			continue
+		}
+		for _, c := range changed {
+			if c == abs || strings.HasPrefix(c, abs+string(filepath.Separator)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+
+	return errA == nil && errB == nil && absA == absB
+}
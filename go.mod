@@ -10,6 +10,7 @@ require (
 	go.starlark.net v0.0.0-20240725214946-42030a7cedce
 	golang.org/x/tools v0.24.0
 	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
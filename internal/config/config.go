@@ -8,6 +8,7 @@ import (
 
 	"github.com/iancoleman/strcase"
 	"github.com/pkg/errors"
+	"go.starlark.net/starlark"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -108,29 +109,136 @@ type (
 	}
 
 	TargetOptions struct {
-		FileMode os.FileMode `yaml:"fileMode"`
+		FileMode    os.FileMode `yaml:"fileMode"`
+		WritePolicy WritePolicy `yaml:"writePolicy"`
+		// KeepPermissions leaves the mode of existing files untouched. New
+		// files get FileMode, or 0644 when it is not set
+		KeepPermissions bool            `yaml:"keepPermissions"`
+		LineEndings     LineEndings     `yaml:"lineEndings"`
+		TrailingNewline TrailingNewline `yaml:"trailingNewline"`
+		// Header starts generated files with a comment stating they are
+		// generated and what they were generated from
+		Header bool `yaml:"header"`
 	}
 
+	// WritePolicy is how a target writes over files that already exist
+	WritePolicy string
+
+	// TargetScope is what a target renders from
+	TargetScope string
+
+	// EachScope is what a target renders one file for. Configs may also set
+	// each to a boolean, true meaning every microservice
+	EachScope string
+
+	// LineEndings normalizes the line endings of generated files. Empty keeps
+	// them as rendered
+	LineEndings string
+
+	// TrailingNewline normalizes the end of generated files. Empty keeps it as
+	// rendered
+	TrailingNewline string
+
+	// TemplateEngine renders the templates of a target. Empty picks it by the
+	// template extension
+	TemplateEngine string
+
 	Target struct {
 		Label        string      `yaml:"label"`
 		TemplatePath string      `yaml:"templatePath"`
 		TemplateDir  string      `yaml:"templateDir"`
 		Apis         []TargetApi `yaml:"apis"`
-		Each         bool        `yaml:"each"`
+		Each         EachScope   `yaml:"each"`
 		// Deprecated. Use DefaultVersionPath
 		DefaultVersion     string `yaml:"defaultVersion"`
 		DefaultVersionPath string
 		Plugins            []string      `yaml:"plugins"`
 		Options            TargetOptions `yaml:"options"`
+		Scope              TargetScope   `yaml:"scope"`
+		// TemplateTree is a directory of templates rendered into the out
+		// path of every target api, one file per template
+		TemplateTree string         `yaml:"templateTree"`
+		Engine       TemplateEngine `yaml:"engine"`
+		// OutPath is the output of project targets
+		OutPath string `yaml:"outPath"`
 	}
 
 	Config struct {
 		Apis        []ApiDefinition `yaml:"apis"`
 		TemplateDir string          `yaml:"templateDir"`
 		Targets     []Target        `yaml:"targets"`
+		// PartialsDir is a directory under TemplateDir holding the partials
+		// shared by every template
+		PartialsDir string `yaml:"partialsDir"`
+		// TemplateFuncs are defined by Starlark configs with
+		// codema.template_func
+		TemplateFuncs TemplateFuncs `yaml:"-"`
+	}
+
+	// TemplateFuncs are template functions defined in Starlark, by name
+	TemplateFuncs struct {
+		Funcs map[string]starlark.Callable
+		// SourceHash hashes the Starlark files the functions were loaded
+		// from, as the functions may change with any of them
+		SourceHash string
 	}
 )
 
+const (
+	// WritePolicyOverwrite replaces the file on every run. It is the default
+	WritePolicyOverwrite WritePolicy = "overwrite"
+	// WritePolicyMerge three-way merges the changes between the previously
+	// and newly generated output into the file on disk, so it can be edited
+	WritePolicyMerge WritePolicy = "merge"
+	// WritePolicyCreateOnly only writes files that do not exist yet, to
+	// scaffold them once
+	WritePolicyCreateOnly WritePolicy = "create-only"
+	// WritePolicyOverwriteIfUnmodified only replaces files that still hold
+	// what codema last wrote to them
+	WritePolicyOverwriteIfUnmodified WritePolicy = "overwrite-if-unmodified"
+)
+
+const (
+	TemplateEngineGo       TemplateEngine = "go"
+	TemplateEnginePlush    TemplateEngine = "plush"
+	TemplateEngineStarlark TemplateEngine = "starlark"
+)
+
+const (
+	// TargetScopeApi renders the apis listed by the target. It is the default
+	TargetScopeApi TargetScope = ""
+	// TargetScopeProject renders a single file from the whole config
+	TargetScopeProject TargetScope = "project"
+)
+
+const (
+	// EachApi renders one file for every api. It is the default
+	EachApi          EachScope = ""
+	EachMicroservice EachScope = "microservice"
+	// EachModel renders one file for the primary and every secondary model
+	// of every microservice
+	EachModel          EachScope = "model"
+	EachSecondaryModel EachScope = "secondary-model"
+	// EachFunction renders one file for every function implementation of
+	// every microservice
+	EachFunction EachScope = "function"
+	// EachEnum renders one file for every enum of the models of every
+	// microservice
+	EachEnum EachScope = "enum"
+)
+
+const (
+	LineEndingsLF   LineEndings = "lf"
+	LineEndingsCRLF LineEndings = "crlf"
+)
+
+const (
+	// TrailingNewlineEnsure ends files with exactly one newline
+	TrailingNewlineEnsure TrailingNewline = "ensure"
+	// TrailingNewlineTrim ends files without a newline
+	TrailingNewlineTrim TrailingNewline = "trim"
+)
+
 const (
 	TagTypeOwner       TagType = "OWNER"
 	TagTypeParent      TagType = "PARENT"
@@ -140,17 +248,31 @@ const (
 type (
 	ConfigLoader interface {
 		GetConfig() (*Config, error)
+		// SourceFiles returns the files read by the last GetConfig call
+		SourceFiles() []string
 	}
 
-	yamlConfigLoader struct{}
+	yamlConfigLoader struct {
+		path string
+	}
 )
 
 func NewYAMLConfigLoader() ConfigLoader {
-	return &yamlConfigLoader{}
+	return NewYAMLConfigLoaderFromPath("codema.yaml")
+}
+
+func NewYAMLConfigLoaderFromPath(path string) ConfigLoader {
+	return &yamlConfigLoader{
+		path: path,
+	}
+}
+
+func (l *yamlConfigLoader) SourceFiles() []string {
+	return []string{l.path}
 }
 
 func (l *yamlConfigLoader) GetConfig() (*Config, error) {
-	data, err := os.ReadFile("codema.yaml")
+	data, err := os.ReadFile(l.path)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -199,6 +321,9 @@ func (l *yamlConfigLoader) GetConfig() (*Config, error) {
 		if t.DefaultVersionPath == "" {
 			config.Targets[tx].DefaultVersionPath = t.DefaultVersion
 		}
+		if err := t.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "target %s", t.Label)
+		}
 
 		for tax, ta := range t.Apis {
 			if ta.VersionPath == "" {
@@ -210,6 +335,134 @@ func (l *yamlConfigLoader) GetConfig() (*Config, error) {
 	return &config, nil
 }
 
+func ParseTargetScope(s string) (TargetScope, error) {
+	switch scope := TargetScope(s); scope {
+	case TargetScopeApi, TargetScopeProject:
+		return scope, nil
+	case "api":
+		return TargetScopeApi, nil
+	default:
+		return "", errors.Errorf("unknown scope %q, must be one of: api, %s", s, TargetScopeProject)
+	}
+}
+
+func (s *TargetScope) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return errors.WithStack(err)
+	}
+
+	scope, err := ParseTargetScope(raw)
+	if err != nil {
+		return err
+	}
+	*s = scope
+
+	return nil
+}
+
+func (t Target) Validate() error {
+	switch t.Engine {
+	case "", TemplateEngineGo, TemplateEnginePlush, TemplateEngineStarlark:
+	default:
+		return errors.Errorf("unknown engine %q, must be one of: %s, %s, %s", t.Engine, TemplateEngineGo, TemplateEnginePlush, TemplateEngineStarlark)
+	}
+
+	if t.TemplateTree != "" {
+		if t.TemplatePath != "" || t.TemplateDir != "" {
+			return errors.New("templateTree cannot be combined with templatePath or templateDir")
+		}
+		if t.Scope == TargetScopeProject {
+			return errors.New("project targets cannot set templateTree")
+		}
+	}
+
+	if t.Scope == TargetScopeProject {
+		if t.OutPath == "" {
+			return errors.New("project targets must set outPath")
+		}
+		if len(t.Apis) > 0 || t.Each != EachApi {
+			return errors.New("project targets render the whole config and cannot set apis or each")
+		}
+	} else if t.OutPath != "" {
+		return errors.New("outPath is only used by project targets, set it on the target apis")
+	}
+
+	return t.Options.Validate()
+}
+
+func ParseEachScope(s string) (EachScope, error) {
+	switch scope := EachScope(s); scope {
+	case EachApi, EachMicroservice, EachModel, EachSecondaryModel, EachFunction, EachEnum:
+		return scope, nil
+	case "api":
+		return EachApi, nil
+	default:
+		return "", errors.Errorf(
+			"unknown each %q, must be a boolean or one of: api, %s, %s, %s, %s, %s",
+			s,
+			EachMicroservice,
+			EachModel,
+			EachSecondaryModel,
+			EachFunction,
+			EachEnum,
+		)
+	}
+}
+
+func (e *EachScope) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var each bool
+	if err := unmarshal(&each); err == nil {
+		*e = EachApi
+		if each {
+			*e = EachMicroservice
+		}
+		return nil
+	}
+
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return errors.WithStack(err)
+	}
+
+	scope, err := ParseEachScope(raw)
+	if err != nil {
+		return err
+	}
+	*e = scope
+
+	return nil
+}
+
+func (o TargetOptions) Validate() error {
+	switch o.WritePolicy {
+	case "", WritePolicyOverwrite, WritePolicyMerge, WritePolicyCreateOnly, WritePolicyOverwriteIfUnmodified:
+	default:
+		return errors.Errorf(
+			"unknown writePolicy %q, must be one of: %s, %s, %s, %s",
+			o.WritePolicy,
+			WritePolicyOverwrite,
+			WritePolicyMerge,
+			WritePolicyCreateOnly,
+			WritePolicyOverwriteIfUnmodified,
+		)
+	}
+
+	switch o.LineEndings {
+	case "", LineEndingsLF, LineEndingsCRLF:
+	default:
+		return errors.Errorf("unknown lineEndings %q, must be one of: %s, %s", o.LineEndings, LineEndingsLF, LineEndingsCRLF)
+	}
+
+	switch o.TrailingNewline {
+	case "", TrailingNewlineEnsure, TrailingNewlineTrim:
+	default:
+		return errors.Errorf("unknown trailingNewline %q, must be one of: %s, %s", o.TrailingNewline, TrailingNewlineEnsure, TrailingNewlineTrim)
+	}
+
+	return nil
+}
+
 func ExpandModulePath(modulePathRaw string) string {
 	modulePath := os.ExpandEnv(
 		strings.ReplaceAll(modulePathRaw, "~", "$HOME"),
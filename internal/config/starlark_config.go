@@ -1,8 +1,13 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -14,19 +19,31 @@ import (
 
 type starlarkConfigLoader struct {
 	baseDir string
+	entry   string
 	cache   map[string]starlark.StringDict
+	sources map[string][]byte
+	// templateFuncs are registered with codema.template_func while loading
+	templateFuncs map[string]starlark.Callable
 }
 
 func NewStarlarkConfigLoader() ConfigLoader {
+	return NewStarlarkConfigLoaderFromPath("codema.star")
+}
+
+func NewStarlarkConfigLoaderFromPath(path string) ConfigLoader {
 	return &starlarkConfigLoader{
-		baseDir: ".",
+		baseDir: filepath.Dir(path),
+		entry:   filepath.Base(path),
 		cache:   make(map[string]starlark.StringDict),
+		sources: make(map[string][]byte),
+
+		templateFuncs: make(map[string]starlark.Callable),
 	}
 }
 
 func (l *starlarkConfigLoader) GetConfig() (*Config, error) {
 	// Load the main Starlark file
-	globals, err := l.loadFile("codema.star")
+	globals, err := l.loadFile(l.entry)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -43,9 +60,49 @@ func (l *starlarkConfigLoader) GetConfig() (*Config, error) {
 		return nil, errors.WithStack(err)
 	}
 
+	if len(l.templateFuncs) > 0 {
+		// Rendering may call the functions concurrently
+		for _, fn := range l.templateFuncs {
+			fn.Freeze()
+		}
+		config.TemplateFuncs = TemplateFuncs{
+			Funcs:      l.templateFuncs,
+			SourceHash: l.sourceHash(),
+		}
+	}
+
 	return &config, nil
 }
 
+// sourceHash hashes every loaded file.
+func (l *starlarkConfigLoader) sourceHash() string {
+	filenames := make([]string, 0, len(l.sources))
+	for filename := range l.sources {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	h := sha256.New()
+	for _, filename := range filenames {
+		fmt.Fprintf(h, "%d:%s%d:%s", len(filename), filename, len(l.sources[filename]), l.sources[filename])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SourceFiles returns the entry file and every file it loaded.
+func (l *starlarkConfigLoader) SourceFiles() []string {
+	files := []string{filepath.Join(l.baseDir, l.entry)}
+	for filename := range l.cache {
+		if filename != l.entry {
+			files = append(files, filepath.Join(l.baseDir, filename))
+		}
+	}
+	sort.Strings(files[1:])
+
+	return files
+}
+
 func (l *starlarkConfigLoader) loadFile(filename string) (starlark.StringDict, error) {
 	// Check if the file has already been loaded
 	if globals, ok := l.cache[filename]; ok {
@@ -65,13 +122,14 @@ func (l *starlarkConfigLoader) loadFile(filename string) (starlark.StringDict, e
 	}
 
 	// Execute the Starlark file
-	globals, err := starlark.ExecFileOptions(syntax.LegacyFileOptions(), thread, filename, data, nil)
+	globals, err := starlark.ExecFileOptions(syntax.LegacyFileOptions(), thread, filename, data, l.predeclared())
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
 	// Cache the result
 	l.cache[filename] = globals
+	l.sources[filename] = data
 
 	return globals, nil
 }
@@ -80,6 +138,76 @@ func (l *starlarkConfigLoader) load(_ *starlark.Thread, module string) (starlark
 	return l.loadFile(module)
 }
 
+// predeclared are the globals of every config file.
+func (l *starlarkConfigLoader) predeclared() starlark.StringDict {
+	return starlark.StringDict{
+		"codema": &starlarkModule{
+			name: "codema",
+			members: starlark.StringDict{
+				"template_func": starlark.NewBuiltin("template_func", l.templateFunc),
+			},
+		},
+	}
+}
+
+var templateFuncNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// templateFunc registers a template function, like
+// codema.template_func("bsonKey", bson_key).
+func (l *starlarkConfigLoader) templateFunc(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var fn starlark.Callable
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "fn", &fn); err != nil {
+		return nil, err
+	}
+
+	if !templateFuncNamePattern.MatchString(name) {
+		return nil, errors.Errorf("%s: %q is not a valid function name", b.Name(), name)
+	}
+	if _, ok := l.templateFuncs[name]; ok {
+		return nil, errors.Errorf("%s: %s is already registered", b.Name(), name)
+	}
+	l.templateFuncs[name] = fn
+
+	return starlark.None, nil
+}
+
+// starlarkModule is a namespace of builtins, like codema.
+type starlarkModule struct {
+	name    string
+	members starlark.StringDict
+}
+
+var _ starlark.HasAttrs = (*starlarkModule)(nil)
+
+func (m *starlarkModule) String() string {
+	return "<module " + m.name + ">"
+}
+
+func (m *starlarkModule) Type() string {
+	return "module"
+}
+
+func (m *starlarkModule) Freeze() {
+	m.members.Freeze()
+}
+
+func (m *starlarkModule) Truth() starlark.Bool {
+	return starlark.True
+}
+
+func (m *starlarkModule) Hash() (uint32, error) {
+	return starlark.String(m.name).Hash()
+}
+
+func (m *starlarkModule) Attr(name string) (starlark.Value, error) {
+	return m.members[name], nil
+}
+
+func (m *starlarkModule) AttrNames() []string {
+	return m.members.Keys()
+}
+
 func fillConfig(c *Config, val starlark.Value) error {
 	dict, ok := val.(*starlark.Dict)
 	if !ok {
@@ -99,6 +227,19 @@ func fillConfig(c *Config, val starlark.Value) error {
 		c.TemplateDir = tmlDirRaw.GoString()
 	}
 
+	// Parsing partialsDir
+	partialsDirVal, found, err := dict.Get(starlark.String("partialsDir"))
+	if err != nil {
+		return err
+	}
+	if found {
+		partialsDirRaw, ok := partialsDirVal.(starlark.String)
+		if !ok {
+			return errors.New("partialsDir must be a string")
+		}
+		c.PartialsDir = partialsDirRaw.GoString()
+	}
+
 	// Parsing Apis
 	apisVal, found, err := dict.Get(starlark.String("apis"))
 	if err != nil {
@@ -656,6 +797,14 @@ func parseTarget(target *Target, dict *starlark.Dict) error {
 	if target.TemplatePath, err = getStringField(dict, "templatePath"); err != nil {
 		return err
 	}
+	if target.TemplateTree, err = getStringField(dict, "templateTree"); err != nil {
+		return err
+	}
+	engine, err := getStringField(dict, "engine")
+	if err != nil {
+		return err
+	}
+	target.Engine = TemplateEngine(engine)
 	if target.DefaultVersion, err = getStringField(dict, "defaultVersion"); err != nil {
 		return err
 	}
@@ -665,16 +814,35 @@ func parseTarget(target *Target, dict *starlark.Dict) error {
 	if target.DefaultVersionPath == "" {
 		target.DefaultVersionPath = target.DefaultVersion
 	}
+	if target.OutPath, err = getStringField(dict, "outPath"); err != nil {
+		return err
+	}
+	scope, err := getStringField(dict, "scope")
+	if err != nil {
+		return err
+	}
+	if target.Scope, err = ParseTargetScope(scope); err != nil {
+		return err
+	}
 	eachVal, found, err := dict.Get(starlark.String("each"))
 	if err != nil {
 		return err
 	}
 	if found {
-		eachBool, ok := eachVal.(starlark.Bool)
-		if !ok {
-			return errors.New("each must be a boolean")
+		switch each := eachVal.(type) {
+		case starlark.Bool:
+			target.Each = EachApi
+			if each {
+				target.Each = EachMicroservice
+			}
+		case starlark.String:
+			target.Each, err = ParseEachScope(string(each))
+			if err != nil {
+				return err
+			}
+		default:
+			return errors.New("each must be a boolean or a string")
 		}
-		target.Each = bool(eachBool)
 	}
 
 	// Parse apis
@@ -784,11 +952,53 @@ func parseTarget(target *Target, dict *starlark.Dict) error {
 
 			target.Options.FileMode = os.FileMode(fileMode)
 		}
+
+		writePolicy, err := getStringField(optionsDict, "writePolicy")
+		if err != nil {
+			return err
+		}
+		target.Options.WritePolicy = WritePolicy(writePolicy)
+
+		keepPermissionsVal, found, err := optionsDict.Get(starlark.String("keepPermissions"))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if found {
+			keepPermissions, ok := keepPermissionsVal.(starlark.Bool)
+			if !ok {
+				return errors.New("keepPermissions must be a boolean")
+			}
+			target.Options.KeepPermissions = bool(keepPermissions)
+		}
+
+		headerVal, found, err := optionsDict.Get(starlark.String("header"))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if found {
+			header, ok := headerVal.(starlark.Bool)
+			if !ok {
+				return errors.New("header must be a boolean")
+			}
+			target.Options.Header = bool(header)
+		}
+
+		lineEndings, err := getStringField(optionsDict, "lineEndings")
+		if err != nil {
+			return err
+		}
+		target.Options.LineEndings = LineEndings(lineEndings)
+
+		trailingNewline, err := getStringField(optionsDict, "trailingNewline")
+		if err != nil {
+			return err
+		}
+		target.Options.TrailingNewline = TrailingNewline(trailingNewline)
 	}
 
 	target.setDefaultOptions()
 
-	return nil
+	return errors.Wrapf(target.Validate(), "target %s", target.Label)
 }
 
 func (t *Target) setDefaultOptions() {
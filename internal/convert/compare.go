@@ -0,0 +1,108 @@
+package convert
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/pkg/errors"
+)
+
+// CompareConfigs returns an error describing the first difference between
+// two configs, or nil when they are identical. Nil and empty collections are
+// considered equal since templates cannot tell them apart.
+func CompareConfigs(a, b *config.Config) error {
+	ra, rb := *a, *b
+	ra.Apis = resolveApis(a.Apis)
+	rb.Apis = resolveApis(b.Apis)
+
+	if diff := diffValues("Config", reflect.ValueOf(ra), reflect.ValueOf(rb)); diff != "" {
+		return errors.New(diff)
+	}
+
+	return nil
+}
+
+func diffValues(path string, a, b reflect.Value) string {
+	if !a.IsValid() || !b.IsValid() {
+		if a.IsValid() != b.IsValid() {
+			return fmt.Sprintf("%s: %s != %s", path, describeValue(a), describeValue(b))
+		}
+		return ""
+	}
+
+	if a.Type() != b.Type() {
+		return fmt.Sprintf("%s: type %s != %s", path, a.Type(), b.Type())
+	}
+
+	switch a.Kind() {
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			name := a.Type().Field(i).Name
+			if diff := diffValues(path+"."+name, a.Field(i), b.Field(i)); diff != "" {
+				return diff
+			}
+		}
+		return ""
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return fmt.Sprintf("%s: %s != %s", path, describeValue(a), describeValue(b))
+		}
+		for i := 0; i < a.Len(); i++ {
+			if diff := diffValues(fmt.Sprintf("%s[%d]", path, i), a.Index(i), b.Index(i)); diff != "" {
+				return diff
+			}
+		}
+		return ""
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return fmt.Sprintf("%s: %s != %s", path, describeValue(a), describeValue(b))
+		}
+		for _, key := range sortedMapKeys(a) {
+			bv := b.MapIndex(key)
+			if !bv.IsValid() {
+				return fmt.Sprintf("%s[%v]: missing", path, key)
+			}
+			if diff := diffValues(fmt.Sprintf("%s[%v]", path, key), a.MapIndex(key), bv); diff != "" {
+				return diff
+			}
+		}
+		return ""
+	case reflect.Interface, reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				return fmt.Sprintf("%s: %s != %s", path, describeValue(a), describeValue(b))
+			}
+			return ""
+		}
+		return diffValues(path, a.Elem(), b.Elem())
+	default:
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return fmt.Sprintf("%s: %s != %s", path, describeValue(a), describeValue(b))
+		}
+		return ""
+	}
+}
+
+func describeValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return "<nil>"
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return fmt.Sprintf("%d item(s)", v.Len())
+	}
+
+	return fmt.Sprintf("%#v", v.Interface())
+}
+
+func sortedMapKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+
+	return keys
+}
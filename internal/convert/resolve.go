@@ -0,0 +1,117 @@
+package convert
+
+import (
+	"fmt"
+
+	"github.com/iancoleman/strcase"
+	"github.com/innovation-upstream/codema/internal/config"
+)
+
+// resolveApis returns a copy of apis with their models resolved the way the
+// Starlark loader resolves them, filling in the derived names, default tag
+// types and directive values the YAML loader leaves as written, so configs
+// of both formats compare equal.
+func resolveApis(apis []config.ApiDefinition) []config.ApiDefinition {
+	if apis == nil {
+		return nil
+	}
+
+	resolved := make([]config.ApiDefinition, len(apis))
+	for ax, a := range apis {
+		resolved[ax] = a
+		if a.Microservices == nil {
+			continue
+		}
+
+		resolved[ax].Microservices = make([]config.MicroserviceDefinition, len(a.Microservices))
+		for ix, m := range a.Microservices {
+			m.PrimaryModel = resolveModel(m.PrimaryModel)
+			if m.SecondaryModels != nil {
+				models := make([]config.ModelDefinition, len(m.SecondaryModels))
+				for sx, sm := range m.SecondaryModels {
+					models[sx] = resolveModel(sm)
+				}
+				m.SecondaryModels = models
+			}
+			resolved[ax].Microservices[ix] = m
+		}
+	}
+
+	return resolved
+}
+
+func resolveModel(model config.ModelDefinition) config.ModelDefinition {
+	model.NameKebab = strcase.ToKebab(model.Name)
+	model.NameCamel = strcase.ToCamel(model.Name)
+	model.NameLowerCamel = strcase.ToLowerCamel(model.Name)
+	model.NameScreaming = strcase.ToScreamingSnake(model.Name)
+	model.NameScreamingSnake = model.NameScreaming
+	model.NameSnake = strcase.ToSnake(model.Name)
+	model.Directives = normalizeDirectives(model.Directives)
+
+	if model.Fields == nil {
+		return model
+	}
+
+	fields := make([]config.FieldDefinition, len(model.Fields))
+	for fx, f := range model.Fields {
+		f.NameKebab = strcase.ToKebab(f.Name)
+		f.NameCamel = strcase.ToCamel(f.Name)
+		f.NameLowerCamel = strcase.ToLowerCamel(f.Name)
+		f.NameScreaming = strcase.ToScreamingSnake(f.Name)
+		f.NameScreamingSnake = f.NameScreaming
+		f.NameSnake = strcase.ToSnake(f.Name)
+		f.Directives = normalizeDirectives(f.Directives)
+
+		if f.Tags != nil {
+			tags := make([]config.TagDefinition, len(f.Tags))
+			for tx, t := range f.Tags {
+				if t.Type == "" {
+					t.Type = config.TagTypeUnspecified
+				}
+				tags[tx] = t
+			}
+			f.Tags = tags
+		}
+		fields[fx] = f
+	}
+	model.Fields = fields
+
+	return model
+}
+
+func normalizeDirectives(directives map[string]interface{}) map[string]interface{} {
+	if directives == nil {
+		return nil
+	}
+
+	result := make(map[string]interface{}, len(directives))
+	for k, v := range directives {
+		result[k] = normalizeYAMLValue(v)
+	}
+
+	return result
+}
+
+// normalizeYAMLValue converts the generic values produced by the YAML decoder
+// into the types produced by the Starlark loader.
+func normalizeYAMLValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = normalizeYAMLValue(item)
+		}
+		return result
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprintf("%v", key)] = normalizeYAMLValue(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
@@ -0,0 +1,554 @@
+package convert
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+	"github.com/innovation-upstream/codema/internal/config"
+	"go.starlark.net/starlark"
+)
+
+const starlarkHelpers = `# Utility functions
+def create_tag(name, type="UNSPECIFIED"):
+    return {"name": name, "type": type}
+
+def create_field(name, type, description="", optional=False, directives=None, tags=None):
+    field = {
+        "name": name,
+        "type": type,
+        "description": description,
+        "optional": optional,
+    }
+    if directives != None:
+        field["directives"] = directives
+    if tags != None:
+        field["tags"] = tags
+    return field
+
+def create_enum(name, values, description=""):
+    return {
+        "name": name,
+        "values": values,
+        "description": description,
+    }
+
+def create_model(name, fields, description="", enums=None, directives=None):
+    model = {
+        "name": name,
+        "fields": fields,
+        "description": description,
+    }
+    if enums != None:
+        model["enums"] = enums
+    if directives != None:
+        model["directives"] = directives
+    return model
+
+def create_function(name, parameters=None, description=""):
+    function = {
+        "name": name,
+        "description": description,
+    }
+    if parameters != None:
+        function["parameters"] = parameters
+    return function
+
+def create_snippets(content_path="", imports_path="", hooks_directory=""):
+    return {
+        "content_path": content_path,
+        "imports_path": imports_path,
+        "hooks_directory": hooks_directory,
+    }
+
+def create_function_implementation(function, target_snippets=None):
+    implementation = {"function": function}
+    if target_snippets != None:
+        implementation["target_snippets"] = target_snippets
+    return implementation
+
+def create_microservice(label, primary_model=None, secondary_models=None, function_implementations=None):
+    microservice = {"label": label}
+    if primary_model != None:
+        microservice["primary_model"] = primary_model
+    if secondary_models != None:
+        microservice["secondary_models"] = secondary_models
+    if function_implementations != None:
+        microservice["function_implementations"] = function_implementations
+    return microservice
+
+def create_api(package, label, microservices=None):
+    api = {"package": package, "label": label}
+    if microservices != None:
+        api["microservices"] = microservices
+    return api
+`
+
+type (
+	starlarkVariable struct {
+		name  string
+		value interface{}
+		code  string
+	}
+
+	starlarkSection struct {
+		title     string
+		variables []starlarkVariable
+	}
+
+	// starlarkEmitter writes config values as variables built with the helper
+	// functions above, reusing a single variable for identical values.
+	starlarkEmitter struct {
+		sections  map[string]*starlarkSection
+		usedNames map[string]bool
+	}
+)
+
+const (
+	sectionTags            = "tags"
+	sectionEnums           = "enums"
+	sectionModels          = "models"
+	sectionFunctions       = "functions"
+	sectionImplementations = "implementations"
+	sectionMicroservices   = "microservices"
+	sectionApis            = "apis"
+)
+
+var starlarkSectionOrder = []struct {
+	key   string
+	title string
+}{
+	{sectionTags, "Tags"},
+	{sectionEnums, "Enums"},
+	{sectionModels, "Models"},
+	{sectionFunctions, "Functions"},
+	{sectionImplementations, "Function implementations"},
+	{sectionMicroservices, "Microservices"},
+	{sectionApis, "APIs"},
+}
+
+// reservedStarlarkNames are the helpers and globals variables must not shadow
+var reservedStarlarkNames = []string{
+	"create_tag", "create_field", "create_enum", "create_model", "create_function",
+	"create_snippets", "create_function_implementation", "create_microservice",
+	"create_api", "config", "models",
+}
+
+var invalidIdentifierChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+func newStarlarkEmitter() *starlarkEmitter {
+	e := &starlarkEmitter{
+		sections:  make(map[string]*starlarkSection),
+		usedNames: make(map[string]bool),
+	}
+	for _, name := range reservedStarlarkNames {
+		e.usedNames[name] = true
+	}
+	for _, s := range starlarkSectionOrder {
+		e.sections[s.key] = &starlarkSection{title: s.title}
+	}
+
+	return e
+}
+
+// ToStarlark renders cfg as a codema.star file.
+func ToStarlark(cfg *config.Config) ([]byte, error) {
+	e := newStarlarkEmitter()
+
+	apiVars := make([]string, 0, len(cfg.Apis))
+	for _, a := range cfg.Apis {
+		name, err := e.api(a)
+		if err != nil {
+			return nil, err
+		}
+		apiVars = append(apiVars, name)
+	}
+
+	root := orderedMap{}
+	if cfg.TemplateDir != "" {
+		root = root.set("templateDir", cfg.TemplateDir)
+	}
+	if cfg.PartialsDir != "" {
+		root = root.set("partialsDir", cfg.PartialsDir)
+	}
+
+	var sb strings.Builder
+	e.writeDefinitions(&sb)
+
+	sb.WriteString("# Configuration\n")
+	sb.WriteString("config = {\n")
+	for _, item := range root {
+		lit, err := starlarkLiteral(item.value, "    ")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&sb, "    %s: %s,\n", starlark.String(item.key).String(), lit)
+	}
+	fmt.Fprintf(&sb, "    \"apis\": %s,\n", formatStarlarkList(apiVars, "    "))
+
+	targets := make([]string, 0, len(cfg.Targets))
+	for _, t := range cfg.Targets {
+		lit, err := starlarkLiteral(targetEntries(t), "        ")
+		if err != nil {
+			return nil, unsupportedValueError("target "+t.Label, err)
+		}
+		targets = append(targets, lit)
+	}
+	fmt.Fprintf(&sb, "    \"targets\": %s,\n", formatStarlarkMultiline(targets, "    "))
+	sb.WriteString("}\n")
+
+	return []byte(sb.String()), nil
+}
+
+// ModelsToStarlark renders standalone enum and model definitions, together
+// with the tags and enums the models use, followed by a models list.
+func ModelsToStarlark(models []config.ModelDefinition, enums []config.EnumDefinition) ([]byte, error) {
+	e := newStarlarkEmitter()
+
+	for _, en := range enums {
+		if _, err := e.enum(en); err != nil {
+			return nil, err
+		}
+	}
+
+	modelVars := make([]string, 0, len(models))
+	for _, m := range models {
+		name, err := e.model(m)
+		if err != nil {
+			return nil, err
+		}
+		modelVars = append(modelVars, name)
+	}
+
+	var sb strings.Builder
+	e.writeDefinitions(&sb)
+	fmt.Fprintf(&sb, "models = %s\n", formatStarlarkMultiline(modelVars, ""))
+
+	return []byte(sb.String()), nil
+}
+
+func (e *starlarkEmitter) writeDefinitions(sb *strings.Builder) {
+	sb.WriteString(starlarkHelpers)
+	sb.WriteString("\n")
+
+	for _, s := range starlarkSectionOrder {
+		section := e.sections[s.key]
+		if len(section.variables) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(sb, "# %s\n", section.title)
+		for _, v := range section.variables {
+			fmt.Fprintf(sb, "%s = %s\n", v.name, v.code)
+			if strings.Contains(v.code, "\n") {
+				sb.WriteString("\n")
+			}
+		}
+		if !strings.HasSuffix(sb.String(), "\n\n") {
+			sb.WriteString("\n")
+		}
+	}
+}
+
+// variable returns the name of the variable holding value, defining it with
+// the code produced by render when no identical value was emitted before.
+func (e *starlarkEmitter) variable(
+	section, baseName string,
+	value interface{},
+	render func() (string, error),
+) (string, error) {
+	s := e.sections[section]
+	for _, v := range s.variables {
+		if reflect.DeepEqual(v.value, value) {
+			return v.name, nil
+		}
+	}
+
+	code, err := render()
+	if err != nil {
+		return "", err
+	}
+
+	name := e.uniqueName(baseName)
+	s.variables = append(s.variables, starlarkVariable{
+		name:  name,
+		value: value,
+		code:  code,
+	})
+
+	return name, nil
+}
+
+func (e *starlarkEmitter) uniqueName(baseName string) string {
+	base := invalidIdentifierChars.ReplaceAllString(baseName, "_")
+	if base == "" || (base[0] >= '0' && base[0] <= '9') {
+		base = "_" + base
+	}
+
+	name := base
+	for i := 2; e.usedNames[name]; i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	e.usedNames[name] = true
+
+	return name
+}
+
+func (e *starlarkEmitter) tag(t config.TagDefinition) (string, error) {
+	return e.variable(sectionTags, "TAG_"+strcase.ToScreamingSnake(t.Name), t, func() (string, error) {
+		args := []string{starlark.String(t.Name).String()}
+		if t.Type != config.TagTypeUnspecified {
+			args = append(args, starlark.String(string(t.Type)).String())
+		}
+		return formatStarlarkCall("create_tag", args, ""), nil
+	})
+}
+
+func (e *starlarkEmitter) enum(en config.EnumDefinition) (string, error) {
+	return e.variable(sectionEnums, strcase.ToSnake(en.Name)+"_enum", en, func() (string, error) {
+		values, err := starlarkLiteral(stringsToValues(en.Values), "")
+		if err != nil {
+			return "", err
+		}
+		args := []string{starlark.String(en.Name).String(), values}
+		if en.Description != "" {
+			args = append(args, starlark.String(en.Description).String())
+		}
+		return formatStarlarkCall("create_enum", args, ""), nil
+	})
+}
+
+func (e *starlarkEmitter) field(f config.FieldDefinition) (string, error) {
+	args := []string{
+		starlark.String(f.Name).String(),
+		starlark.String(f.Type).String(),
+	}
+	if f.Description != "" {
+		args = append(args, starlark.String(f.Description).String())
+	}
+	if f.Optional {
+		args = append(args, "optional=True")
+	}
+	if f.Directives != nil {
+		lit, err := starlarkLiteral(f.Directives, "        ")
+		if err != nil {
+			return "", unsupportedValueError("directives of field "+f.Name, err)
+		}
+		args = append(args, "directives="+lit)
+	}
+	if f.Tags != nil {
+		tags := make([]string, 0, len(f.Tags))
+		for _, t := range f.Tags {
+			name, err := e.tag(t)
+			if err != nil {
+				return "", err
+			}
+			tags = append(tags, name)
+		}
+		args = append(args, "tags="+formatStarlarkList(tags, "        "))
+	}
+
+	return "create_field(" + strings.Join(args, ", ") + ")", nil
+}
+
+func (e *starlarkEmitter) model(m config.ModelDefinition) (string, error) {
+	return e.variable(sectionModels, strcase.ToSnake(m.Name)+"_model", m, func() (string, error) {
+		fields := make([]string, 0, len(m.Fields))
+		for _, f := range m.Fields {
+			field, err := e.field(f)
+			if err != nil {
+				return "", err
+			}
+			fields = append(fields, field)
+		}
+
+		args := []string{
+			starlark.String(m.Name).String(),
+			formatStarlarkMultiline(fields, "    "),
+		}
+		if m.Description != "" {
+			args = append(args, starlark.String(m.Description).String())
+		}
+		if m.Enums != nil {
+			enums := make([]string, 0, len(m.Enums))
+			for _, en := range m.Enums {
+				name, err := e.enum(en)
+				if err != nil {
+					return "", err
+				}
+				enums = append(enums, name)
+			}
+			args = append(args, "enums="+formatStarlarkList(enums, "    "))
+		}
+		if m.Directives != nil {
+			lit, err := starlarkLiteral(m.Directives, "    ")
+			if err != nil {
+				return "", unsupportedValueError("directives of model "+m.Name, err)
+			}
+			args = append(args, "directives="+lit)
+		}
+
+		return formatStarlarkCall("create_model", args, ""), nil
+	})
+}
+
+func (e *starlarkEmitter) function(f config.FunctionDefinition) (string, error) {
+	return e.variable(sectionFunctions, strcase.ToSnake(f.Name)+"_function", f, func() (string, error) {
+		args := []string{starlark.String(f.Name).String()}
+		if f.Parameters != nil {
+			params, err := starlarkLiteral(stringsToValues(f.Parameters), "    ")
+			if err != nil {
+				return "", err
+			}
+			args = append(args, params)
+		}
+		if f.Description != "" {
+			if f.Parameters == nil {
+				args = append(args, "description="+starlark.String(f.Description).String())
+			} else {
+				args = append(args, starlark.String(f.Description).String())
+			}
+		}
+		return formatStarlarkCall("create_function", args, ""), nil
+	})
+}
+
+func (e *starlarkEmitter) implementation(fi config.FunctionImplementation) (string, error) {
+	return e.variable(sectionImplementations, strcase.ToSnake(fi.Function.Name)+"_implementation", fi, func() (string, error) {
+		function, err := e.function(fi.Function)
+		if err != nil {
+			return "", err
+		}
+
+		args := []string{function}
+		if fi.TargetSnippets != nil {
+			snippets := make([]string, 0, len(fi.TargetSnippets))
+			for _, label := range sortedKeys(fi.TargetSnippets) {
+				sp := fi.TargetSnippets[label]
+				snippetArgs := []string{}
+				if sp.ContentPath != "" {
+					snippetArgs = append(snippetArgs, starlark.String(sp.ContentPath).String())
+				}
+				if sp.ImportsPath != "" {
+					snippetArgs = append(snippetArgs, "imports_path="+starlark.String(sp.ImportsPath).String())
+				}
+				if sp.HooksDirectory != "" {
+					snippetArgs = append(snippetArgs, "hooks_directory="+starlark.String(sp.HooksDirectory).String())
+				}
+				snippets = append(snippets, starlark.String(label).String()+": create_snippets("+strings.Join(snippetArgs, ", ")+")")
+			}
+			args = append(args, formatStarlarkDictMultiline(snippets, "    "))
+		}
+
+		return formatStarlarkCall("create_function_implementation", args, ""), nil
+	})
+}
+
+func (e *starlarkEmitter) microservice(ms config.MicroserviceDefinition) (string, error) {
+	return e.variable(sectionMicroservices, strcase.ToSnake(ms.Label)+"_microservice", ms, func() (string, error) {
+		args := []string{starlark.String(ms.Label).String()}
+
+		if !reflect.DeepEqual(ms.PrimaryModel, config.ModelDefinition{}) {
+			name, err := e.model(ms.PrimaryModel)
+			if err != nil {
+				return "", err
+			}
+			args = append(args, "primary_model="+name)
+		}
+		if ms.SecondaryModels != nil {
+			models := make([]string, 0, len(ms.SecondaryModels))
+			for _, m := range ms.SecondaryModels {
+				name, err := e.model(m)
+				if err != nil {
+					return "", err
+				}
+				models = append(models, name)
+			}
+			args = append(args, "secondary_models="+formatStarlarkList(models, "    "))
+		}
+		if ms.FunctionImplementations != nil {
+			impls := make([]string, 0, len(ms.FunctionImplementations))
+			for _, fi := range ms.FunctionImplementations {
+				name, err := e.implementation(fi)
+				if err != nil {
+					return "", err
+				}
+				impls = append(impls, name)
+			}
+			args = append(args, "function_implementations="+formatStarlarkList(impls, "    "))
+		}
+
+		return formatStarlarkCall("create_microservice", args, ""), nil
+	})
+}
+
+func (e *starlarkEmitter) api(a config.ApiDefinition) (string, error) {
+	return e.variable(sectionApis, strcase.ToSnake(a.Label)+"_api", a, func() (string, error) {
+		args := []string{
+			starlark.String(a.Package).String(),
+			starlark.String(a.Label).String(),
+		}
+		if a.Microservices != nil {
+			microservices := make([]string, 0, len(a.Microservices))
+			for _, ms := range a.Microservices {
+				name, err := e.microservice(ms)
+				if err != nil {
+					return "", err
+				}
+				microservices = append(microservices, name)
+			}
+			args = append(args, formatStarlarkList(microservices, "    "))
+		}
+		return formatStarlarkCall("create_api", args, ""), nil
+	})
+}
+
+// formatStarlarkCall keeps short calls on one line and otherwise puts every
+// argument on its own line, like the hand written configs do.
+func formatStarlarkCall(fn string, args []string, indent string) string {
+	inline := fn + "(" + strings.Join(args, ", ") + ")"
+	if len(indent)+len(inline) <= 100 && !strings.Contains(inline, "\n") {
+		return inline
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fn + "(\n")
+	for _, arg := range args {
+		sb.WriteString(indent + "    " + arg + ",\n")
+	}
+	sb.WriteString(indent + ")")
+
+	return sb.String()
+}
+
+func formatStarlarkMultiline(items []string, indent string) string {
+	if len(items) == 0 {
+		return "[]"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("[\n")
+	for _, item := range items {
+		sb.WriteString(indent + "    " + item + ",\n")
+	}
+	sb.WriteString(indent + "]")
+
+	return sb.String()
+}
+
+func formatStarlarkDictMultiline(items []string, indent string) string {
+	if len(items) == 0 {
+		return "{}"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	for _, item := range items {
+		sb.WriteString(indent + "    " + item + ",\n")
+	}
+	sb.WriteString(indent + "}")
+
+	return sb.String()
+}
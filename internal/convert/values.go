@@ -0,0 +1,310 @@
+package convert
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/pkg/errors"
+	"go.starlark.net/starlark"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	// entry is a single key of an orderedMap
+	entry struct {
+		key   string
+		value interface{}
+	}
+
+	// orderedMap is the format neutral representation of a config dictionary
+	// shared by the Starlark and YAML emitters, so a new config key only has
+	// to be described once.
+	orderedMap []entry
+
+	// octalMode is a file mode, written the way both loaders parse it
+	octalMode os.FileMode
+)
+
+func (m orderedMap) set(key string, value interface{}) orderedMap {
+	return append(m, entry{key: key, value: value})
+}
+
+func targetEntries(t config.Target) orderedMap {
+	m := orderedMap{}.set("label", t.Label)
+
+	if t.TemplateDir != "" {
+		m = m.set("templateDir", t.TemplateDir)
+	}
+	if t.TemplatePath != "" {
+		m = m.set("templatePath", t.TemplatePath)
+	}
+	if t.TemplateTree != "" {
+		m = m.set("templateTree", t.TemplateTree)
+	}
+	if t.Engine != "" {
+		m = m.set("engine", string(t.Engine))
+	}
+	switch t.Each {
+	case config.EachApi:
+	case config.EachMicroservice:
+		m = m.set("each", true)
+	default:
+		m = m.set("each", string(t.Each))
+	}
+	if t.DefaultVersion != "" {
+		m = m.set("defaultVersion", t.DefaultVersion)
+	}
+	if t.DefaultVersionPath != t.DefaultVersion {
+		m = m.set("defaultVersionPath", t.DefaultVersionPath)
+	}
+
+	if t.Scope == config.TargetScopeProject {
+		m = m.set("scope", string(t.Scope)).set("outPath", t.OutPath)
+	} else {
+		apis := make([]interface{}, 0, len(t.Apis))
+		for _, ta := range t.Apis {
+			apis = append(apis, targetApiEntries(ta))
+		}
+		m = m.set("apis", apis)
+	}
+
+	if t.Plugins != nil {
+		m = m.set("plugins", stringsToValues(t.Plugins))
+	}
+
+	options := targetOptionsEntries(t.Options)
+	if len(options) > 0 {
+		m = m.set("options", options)
+	}
+
+	return m
+}
+
+func targetApiEntries(ta config.TargetApi) orderedMap {
+	m := orderedMap{}.
+		set("label", ta.Label).
+		set("outPath", ta.OutPath)
+
+	if ta.Version != "" {
+		m = m.set("version", ta.Version)
+	}
+	if ta.VersionPath != ta.Version {
+		m = m.set("versionPath", ta.VersionPath)
+	}
+	if ta.SkipLabels != nil {
+		m = m.set("skipLabels", stringsToValues(ta.SkipLabels))
+	}
+
+	return m
+}
+
+func targetOptionsEntries(o config.TargetOptions) orderedMap {
+	m := orderedMap{}
+
+	if o.FileMode != 0 {
+		m = m.set("fileMode", octalMode(o.FileMode))
+	}
+	if o.WritePolicy != "" {
+		m = m.set("writePolicy", string(o.WritePolicy))
+	}
+	if o.KeepPermissions {
+		m = m.set("keepPermissions", true)
+	}
+	if o.LineEndings != "" {
+		m = m.set("lineEndings", string(o.LineEndings))
+	}
+	if o.TrailingNewline != "" {
+		m = m.set("trailingNewline", string(o.TrailingNewline))
+	}
+	if o.Header {
+		m = m.set("header", true)
+	}
+
+	return m
+}
+
+func stringsToValues(s []string) []interface{} {
+	values := make([]interface{}, len(s))
+	for i, v := range s {
+		values[i] = v
+	}
+
+	return values
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// starlarkLiteral formats a config value as a Starlark expression.
+func starlarkLiteral(v interface{}, indent string) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "None", nil
+	case bool:
+		if v {
+			return "True", nil
+		}
+		return "False", nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return starlark.Float(v).String(), nil
+	case string:
+		return starlark.String(v).String(), nil
+	case octalMode:
+		return strconv.FormatUint(uint64(v), 8), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			lit, err := starlarkLiteral(item, indent+"    ")
+			if err != nil {
+				return "", err
+			}
+			items[i] = lit
+		}
+		return formatStarlarkList(items, indent), nil
+	case map[string]interface{}:
+		m := orderedMap{}
+		for _, k := range sortedKeys(v) {
+			m = m.set(k, v[k])
+		}
+		return starlarkLiteral(m, indent)
+	case map[interface{}]interface{}:
+		return starlarkLiteral(normalizeYAMLValue(v), indent)
+	case orderedMap:
+		items := make([]string, len(v))
+		for i, e := range v {
+			lit, err := starlarkLiteral(e.value, indent+"    ")
+			if err != nil {
+				return "", err
+			}
+			items[i] = starlark.String(e.key).String() + ": " + lit
+		}
+		return formatStarlarkDict(items, indent), nil
+	default:
+		return "", errors.Errorf("unsupported config value type %T", v)
+	}
+}
+
+func formatStarlarkList(items []string, indent string) string {
+	return formatStarlarkCollection("[", "]", items, indent)
+}
+
+func formatStarlarkDict(items []string, indent string) string {
+	return formatStarlarkCollection("{", "}", items, indent)
+}
+
+// formatStarlarkCollection keeps short collections on one line and breaks
+// long or nested ones into one item per line.
+func formatStarlarkCollection(open, close string, items []string, indent string) string {
+	if len(items) == 0 {
+		return open + close
+	}
+
+	inline := open + strings.Join(items, ", ") + close
+	if len(indent)+len(inline) <= 80 && !strings.Contains(inline, "\n") {
+		return inline
+	}
+
+	var sb strings.Builder
+	sb.WriteString(open + "\n")
+	for _, item := range items {
+		sb.WriteString(indent + "    " + item + ",\n")
+	}
+	sb.WriteString(indent + close)
+
+	return sb.String()
+}
+
+// writeYAML writes v as block style YAML. The YAML is written by hand rather
+// than with yaml.Marshal to keep key order, octal file modes and whole floats.
+func writeYAML(sb *strings.Builder, v interface{}, indent string) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := orderedMap{}
+		for _, k := range sortedKeys(v) {
+			m = m.set(k, v[k])
+		}
+		return writeYAML(sb, m, indent)
+	case map[interface{}]interface{}:
+		return writeYAML(sb, normalizeYAMLValue(v), indent)
+	case orderedMap:
+		if len(v) == 0 {
+			sb.WriteString(" {}\n")
+			return nil
+		}
+		if indent != "" || sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		for _, e := range v {
+			key, err := yamlScalar(e.key)
+			if err != nil {
+				return err
+			}
+			sb.WriteString(indent + key + ":")
+			if err := writeYAML(sb, e.value, indent+"  "); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		if len(v) == 0 {
+			sb.WriteString(" []\n")
+			return nil
+		}
+		sb.WriteString("\n")
+		for _, item := range v {
+			sb.WriteString(indent + "-")
+			var itemSb strings.Builder
+			if err := writeYAML(&itemSb, item, indent+"  "); err != nil {
+				return err
+			}
+			// Put the first key of a mapping on the same line as the dash
+			sb.WriteString(strings.Replace(itemSb.String(), "\n"+indent+"  ", " ", 1))
+		}
+		return nil
+	default:
+		scalar, err := yamlScalar(v)
+		if err != nil {
+			return err
+		}
+		sb.WriteString(" " + scalar + "\n")
+		return nil
+	}
+}
+
+func yamlScalar(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "null", nil
+	case octalMode:
+		return "0" + strconv.FormatUint(uint64(v), 8), nil
+	case float64:
+		return starlark.Float(v).String(), nil
+	case bool, int, int64, string:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		return strings.TrimSuffix(string(data), "\n"), nil
+	default:
+		return "", errors.Errorf("unsupported config value type %T", v)
+	}
+}
+
+func unsupportedValueError(path string, err error) error {
+	return errors.Wrap(err, fmt.Sprintf("failed to convert %s", path))
+}
@@ -0,0 +1,209 @@
+package convert
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/pkg/errors"
+)
+
+// yamlTargetKeys are the target keys YAML configs spell as the lowercased
+// names of their Go fields, which have no yaml tags.
+var yamlTargetKeys = map[string]string{
+	"defaultVersionPath": "defaultversionpath",
+	"versionPath":        "versionpath",
+}
+
+// ToYAML renders cfg as a codema.yaml file.
+func ToYAML(cfg *config.Config) ([]byte, error) {
+	if len(cfg.TemplateFuncs.Funcs) > 0 {
+		return nil, errors.New("template functions defined in Starlark cannot be converted to YAML")
+	}
+
+	root := orderedMap{}
+	if cfg.TemplateDir != "" {
+		root = root.set("templateDir", cfg.TemplateDir)
+	}
+	if cfg.PartialsDir != "" {
+		root = root.set("partialsDir", cfg.PartialsDir)
+	}
+
+	apis := make([]interface{}, 0, len(cfg.Apis))
+	for _, a := range cfg.Apis {
+		apis = append(apis, apiEntries(a))
+	}
+	root = root.set("apis", apis)
+
+	targets := make([]interface{}, 0, len(cfg.Targets))
+	for _, t := range cfg.Targets {
+		targets = append(targets, renameKeys(targetEntries(t), yamlTargetKeys))
+	}
+	root = root.set("targets", targets)
+
+	var sb strings.Builder
+	if err := writeYAML(&sb, root, ""); err != nil {
+		return nil, err
+	}
+
+	return []byte(sb.String()), nil
+}
+
+func apiEntries(a config.ApiDefinition) orderedMap {
+	m := orderedMap{}.
+		set("package", a.Package).
+		set("label", a.Label)
+
+	if a.Microservices != nil {
+		microservices := make([]interface{}, 0, len(a.Microservices))
+		for _, ms := range a.Microservices {
+			microservices = append(microservices, microserviceEntries(ms))
+		}
+		m = m.set("microservices", microservices)
+	}
+
+	return m
+}
+
+func microserviceEntries(ms config.MicroserviceDefinition) orderedMap {
+	m := orderedMap{}.set("label", ms.Label)
+
+	if !reflect.DeepEqual(ms.PrimaryModel, config.ModelDefinition{}) {
+		m = m.set("primarymodel", modelEntries(ms.PrimaryModel))
+	}
+	if ms.SecondaryModels != nil {
+		models := make([]interface{}, 0, len(ms.SecondaryModels))
+		for _, sm := range ms.SecondaryModels {
+			models = append(models, modelEntries(sm))
+		}
+		m = m.set("secondarymodels", models)
+	}
+	if ms.FunctionImplementations != nil {
+		impls := make([]interface{}, 0, len(ms.FunctionImplementations))
+		for _, fi := range ms.FunctionImplementations {
+			impls = append(impls, implementationEntries(fi))
+		}
+		m = m.set("functionimplementations", impls)
+	}
+
+	return m
+}
+
+func modelEntries(model config.ModelDefinition) orderedMap {
+	m := orderedMap{}.set("name", model.Name)
+
+	if model.Description != "" {
+		m = m.set("description", model.Description)
+	}
+	if model.Enums != nil {
+		enums := make([]interface{}, 0, len(model.Enums))
+		for _, en := range model.Enums {
+			enum := orderedMap{}.
+				set("name", en.Name).
+				set("values", stringsToValues(en.Values))
+			if en.Description != "" {
+				enum = enum.set("description", en.Description)
+			}
+			enums = append(enums, enum)
+		}
+		m = m.set("enums", enums)
+	}
+
+	fields := make([]interface{}, 0, len(model.Fields))
+	for _, f := range model.Fields {
+		fields = append(fields, fieldEntries(f))
+	}
+	m = m.set("fields", fields)
+
+	if model.Directives != nil {
+		m = m.set("directives", model.Directives)
+	}
+
+	return m
+}
+
+func fieldEntries(f config.FieldDefinition) orderedMap {
+	m := orderedMap{}.
+		set("name", f.Name).
+		set("type", f.Type)
+
+	if f.Description != "" {
+		m = m.set("description", f.Description)
+	}
+	if f.Optional {
+		m = m.set("optional", true)
+	}
+	if f.Directives != nil {
+		m = m.set("directives", f.Directives)
+	}
+	if f.Tags != nil {
+		tags := make([]interface{}, 0, len(f.Tags))
+		for _, t := range f.Tags {
+			tags = append(tags, orderedMap{}.
+				set("name", t.Name).
+				set("type", string(t.Type)))
+		}
+		m = m.set("tags", tags)
+	}
+
+	return m
+}
+
+func implementationEntries(fi config.FunctionImplementation) orderedMap {
+	function := orderedMap{}.set("name", fi.Function.Name)
+	if fi.Function.Parameters != nil {
+		function = function.set("parameters", stringsToValues(fi.Function.Parameters))
+	}
+	if fi.Function.Description != "" {
+		function = function.set("description", fi.Function.Description)
+	}
+
+	m := orderedMap{}.set("function", function)
+	if fi.TargetSnippets != nil {
+		snippets := orderedMap{}
+		for _, label := range sortedKeys(fi.TargetSnippets) {
+			sp := fi.TargetSnippets[label]
+			paths := orderedMap{}
+			if sp.ContentPath != "" {
+				paths = paths.set("contentpath", sp.ContentPath)
+			}
+			if sp.ImportsPath != "" {
+				paths = paths.set("importspath", sp.ImportsPath)
+			}
+			if sp.HooksDirectory != "" {
+				paths = paths.set("hooksdirectory", sp.HooksDirectory)
+			}
+			snippets = snippets.set(label, paths)
+		}
+		m = m.set("targetsnippets", snippets)
+	}
+
+	return m
+}
+
+// renameKeys renames the keys of m and of the maps nested in it.
+func renameKeys(m orderedMap, keys map[string]string) orderedMap {
+	renamed := make(orderedMap, 0, len(m))
+	for _, e := range m {
+		if key, ok := keys[e.key]; ok {
+			e.key = key
+		}
+		switch value := e.value.(type) {
+		case orderedMap:
+			e.value = renameKeys(value, keys)
+		case []interface{}:
+			items := make([]interface{}, len(value))
+			for i, item := range value {
+				if item, ok := item.(orderedMap); ok {
+					items[i] = renameKeys(item, keys)
+					continue
+				}
+				items[i] = item
+			}
+			e.value = items
+		}
+		renamed = append(renamed, e)
+	}
+
+	return renamed
+}
@@ -0,0 +1,242 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	OpKind int
+
+	// Edit is a single line of a diff. OldLine and NewLine are the zero based
+	// indexes of the line in the old and new input, -1 where it is absent.
+	Edit struct {
+		Kind    OpKind
+		OldLine int
+		NewLine int
+		Text    string
+	}
+)
+
+const (
+	OpEqual OpKind = iota
+	OpDelete
+	OpInsert
+)
+
+// SplitLines splits content into lines, keeping the line endings so content
+// without a trailing newline is told apart.
+func SplitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// Lines returns the shortest edit script turning a into b, using the linear
+// space variant of the Myers algorithm.
+func Lines(a, b []string) []Edit {
+	size := 2*(len(a)+len(b)) + 3
+	d := &differ{
+		a:  a,
+		b:  b,
+		vf: make([]int, size),
+		vb: make([]int, size),
+	}
+	d.compare(0, len(a), 0, len(b))
+
+	return d.edits
+}
+
+// differ holds the state of Lines. vf and vb are the furthest reaching
+// paths by diagonal of the forward and backward searches, shared by every
+// step since each search is done before the next one starts.
+type differ struct {
+	a, b   []string
+	vf, vb []int
+	edits  []Edit
+}
+
+// compare appends the edits turning a[aLo:aHi] into b[bLo:bHi], splitting
+// them at the middle snake of the shortest path between them.
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.equal(aLo, bLo)
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-1-suffix] == d.b[bHi-1-suffix] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi:
+		for y := bLo; y < bHi; y++ {
+			d.edits = append(d.edits, Edit{Kind: OpInsert, OldLine: -1, NewLine: y, Text: d.b[y]})
+		}
+	case bLo == bHi:
+		for x := aLo; x < aHi; x++ {
+			d.edits = append(d.edits, Edit{Kind: OpDelete, OldLine: x, NewLine: -1, Text: d.a[x]})
+		}
+	default:
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		for ; x < u; x, y = x+1, y+1 {
+			d.equal(x, y)
+		}
+		d.compare(u, aHi, v, bHi)
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.equal(aHi+i, bHi+i)
+	}
+}
+
+func (d *differ) equal(x, y int) {
+	d.edits = append(d.edits, Edit{Kind: OpEqual, OldLine: x, NewLine: y, Text: d.a[x]})
+}
+
+// middleSnake searches the shortest path from both ends at once, and returns
+// the snake from (x, y) to (u, v) where the searches meet.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	offset := len(d.vf) / 2
+	vf, vb := d.vf, d.vb
+	vf[offset+1] = 0
+	vb[offset+1] = 0
+
+	// The backward search runs on the reversed inputs: its diagonal kb is
+	// the forward diagonal delta-kb
+	for step := 0; step <= (n+m+1)/2; step++ {
+		for k := -step; k <= step; k += 2 {
+			if k == -step || (k != step && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y = x - k
+			u, v = x, y
+			for u < n && v < m && d.a[aLo+u] == d.b[bLo+v] {
+				u++
+				v++
+			}
+			vf[offset+k] = u
+			if kb := delta - k; odd && kb >= -(step-1) && kb <= step-1 && u+vb[offset+kb] >= n {
+				return aLo + x, bLo + y, aLo + u, bLo + v
+			}
+		}
+
+		for kb := -step; kb <= step; kb += 2 {
+			if kb == -step || (kb != step && vb[offset+kb-1] < vb[offset+kb+1]) {
+				x = vb[offset+kb+1]
+			} else {
+				x = vb[offset+kb-1] + 1
+			}
+			y = x - kb
+			u, v = x, y
+			for u < n && v < m && d.a[aHi-1-u] == d.b[bHi-1-v] {
+				u++
+				v++
+			}
+			vb[offset+kb] = u
+			if k := delta - kb; !odd && k >= -step && k <= step && vf[offset+k]+u >= n {
+				return aHi - u, bHi - v, aHi - x, bHi - y
+			}
+		}
+	}
+
+	// The searches always meet before
+	panic("diff: no middle snake")
+}
+
+// Unified returns a unified diff of old and new with context lines around
+// every change, or an empty string when they are equal.
+func Unified(oldName, newName string, old, new []byte, context int) string {
+	edits := Lines(SplitLines(old), SplitLines(new))
+
+	// Line positions before every edit, for the hunk headers
+	oldPos := make([]int, len(edits)+1)
+	newPos := make([]int, len(edits)+1)
+	var changes []int
+	for i, e := range edits {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if e.Kind != OpInsert {
+			oldPos[i+1]++
+		}
+		if e.Kind != OpDelete {
+			newPos[i+1]++
+		}
+		if e.Kind != OpEqual {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	// Group the changes into hunks, merging hunks whose context overlaps
+	type hunk struct{ start, end int }
+	var hunks []hunk
+	for _, c := range changes {
+		start := c - context
+		if start < 0 {
+			start = 0
+		}
+		end := c + 1 + context
+		if end > len(edits) {
+			end = len(edits)
+		}
+		if len(hunks) > 0 && start <= hunks[len(hunks)-1].end {
+			hunks[len(hunks)-1].end = end
+			continue
+		}
+		hunks = append(hunks, hunk{start, end})
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks {
+		oldCount := oldPos[h.end] - oldPos[h.start]
+		newCount := newPos[h.end] - newPos[h.start]
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(oldPos[h.start], oldCount), hunkRange(newPos[h.start], newCount))
+
+		for _, e := range edits[h.start:h.end] {
+			switch e.Kind {
+			case OpEqual:
+				sb.WriteString(" ")
+			case OpDelete:
+				sb.WriteString("-")
+			case OpInsert:
+				sb.WriteString("+")
+			}
+			sb.WriteString(e.Text)
+			if !strings.HasSuffix(e.Text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
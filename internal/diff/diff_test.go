@@ -0,0 +1,123 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []string
+	}{
+		{name: "both empty", a: "", b: "", want: nil},
+		{name: "empty to non-empty", a: "", b: "ab", want: []string{"+a", "+b"}},
+		{name: "non-empty to empty", a: "ab", b: "", want: []string{"-a", "-b"}},
+		{name: "identical", a: "abc", b: "abc", want: []string{"=a", "=b", "=c"}},
+		{name: "pure insert", a: "ad", b: "abcd", want: []string{"=a", "+b", "+c", "=d"}},
+		{name: "pure delete", a: "abcd", b: "ad", want: []string{"=a", "-b", "-c", "=d"}},
+		{name: "replace", a: "abc", b: "axc", want: []string{"=a", "-b", "+x", "=c"}},
+		{name: "moved line", a: "abcd", b: "bcda", want: []string{"-a", "=b", "=c", "=d", "+a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := strings.Split(tt.a, ""), strings.Split(tt.b, "")
+			edits := Lines(a, b)
+			checkEdits(t, a, b, edits)
+
+			var got []string
+			for _, e := range edits {
+				got = append(got, "=-+"[e.Kind:e.Kind+1]+e.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinesLargeRewrite(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 2000; i++ {
+		a = append(a, fmt.Sprintf("old %d\n", i))
+		b = append(b, fmt.Sprintf("new %d\n", i))
+		// Lines kept every hundred lines
+		if i%100 == 0 {
+			a = append(a, fmt.Sprintf("kept %d\n", i))
+			b = append(b, fmt.Sprintf("kept %d\n", i))
+		}
+	}
+
+	edits := Lines(a, b)
+	checkEdits(t, a, b, edits)
+
+	var changes int
+	for _, e := range edits {
+		if e.Kind != OpEqual {
+			changes++
+		}
+	}
+	if want := 2 * 2000; changes != want {
+		t.Errorf("got %d changed lines, want %d", changes, want)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	old := []byte("a\nb\nc\nd\ne\nf\ng\nh\n")
+	new := []byte("a\nb\nc\nD\ne\nf\ng\nh\ni")
+
+	want := `--- old
++++ new
+@@ -2,7 +2,8 @@
+ b
+ c
+-d
++D
+ e
+ f
+ g
+ h
++i
+\ No newline at end of file
+`
+	if got := Unified("old", "new", old, new, 2); got != want {
+		t.Errorf("Unified() =\n%s\nwant\n%s", got, want)
+	}
+	if got := Unified("old", "new", old, old, 2); got != "" {
+		t.Errorf("Unified() of equal content = %q, want empty", got)
+	}
+}
+
+// checkEdits checks that edits is a valid edit script turning a into b.
+func checkEdits(t *testing.T, a, b []string, edits []Edit) {
+	t.Helper()
+
+	x, y := 0, 0
+	for i, e := range edits {
+		switch e.Kind {
+		case OpEqual:
+			if e.OldLine != x || e.NewLine != y || x >= len(a) || y >= len(b) || a[x] != e.Text || b[y] != e.Text {
+				t.Fatalf("edit %d %+v is not an equal line at %d, %d", i, e, x, y)
+			}
+			x++
+			y++
+		case OpDelete:
+			if e.OldLine != x || e.NewLine != -1 || x >= len(a) || a[x] != e.Text {
+				t.Fatalf("edit %d %+v does not delete line %d", i, e, x)
+			}
+			x++
+		case OpInsert:
+			if e.OldLine != -1 || e.NewLine != y || y >= len(b) || b[y] != e.Text {
+				t.Fatalf("edit %d %+v does not insert line %d", i, e, y)
+			}
+			y++
+		}
+	}
+	if x != len(a) || y != len(b) {
+		t.Fatalf("edits end at %d, %d, want %d, %d", x, y, len(a), len(b))
+	}
+}
@@ -0,0 +1,116 @@
+package diff
+
+import (
+	"strings"
+)
+
+// MergeResult is the outcome of a three-way merge. Content holds conflict
+// markers around every chunk both sides changed differently.
+type MergeResult struct {
+	Content   []byte
+	Conflicts int
+}
+
+// Merge3 merges the changes from base to ours and from base to theirs. The
+// labels name the sides in conflict markers.
+func Merge3(base, ours, theirs []byte, oursLabel, theirsLabel string) MergeResult {
+	baseLines := SplitLines(base)
+	oursLines := SplitLines(ours)
+	theirsLines := SplitLines(theirs)
+
+	matchOurs := matchBaseLines(baseLines, oursLines)
+	matchTheirs := matchBaseLines(baseLines, theirsLines)
+
+	var out strings.Builder
+	var conflicts int
+	i, a, b := 0, 0, 0
+	for i < len(baseLines) || a < len(oursLines) || b < len(theirsLines) {
+		// Lines kept by both sides are stable
+		if i < len(baseLines) && matchOurs[i] == a && matchTheirs[i] == b {
+			out.WriteString(baseLines[i])
+			i, a, b = i+1, a+1, b+1
+			continue
+		}
+
+		// Find the next base line both sides kept, everything before it is a
+		// chunk changed by at least one side
+		nextI, nextA, nextB := len(baseLines), len(oursLines), len(theirsLines)
+		for j := i; j < len(baseLines); j++ {
+			if matchOurs[j] >= 0 && matchTheirs[j] >= 0 {
+				nextI, nextA, nextB = j, matchOurs[j], matchTheirs[j]
+				break
+			}
+		}
+
+		baseChunk := baseLines[i:nextI]
+		oursChunk := oursLines[a:nextA]
+		theirsChunk := theirsLines[b:nextB]
+
+		switch {
+		case equalLines(oursChunk, baseChunk):
+			writeLines(&out, theirsChunk)
+		case equalLines(theirsChunk, baseChunk), equalLines(oursChunk, theirsChunk):
+			writeLines(&out, oursChunk)
+		default:
+			conflicts++
+			writeMarker(&out, "<<<<<<< "+oursLabel)
+			writeLines(&out, oursChunk)
+			writeMarker(&out, "=======")
+			writeLines(&out, theirsChunk)
+			writeMarker(&out, ">>>>>>> "+theirsLabel)
+		}
+
+		i, a, b = nextI, nextA, nextB
+	}
+
+	return MergeResult{
+		Content:   []byte(out.String()),
+		Conflicts: conflicts,
+	}
+}
+
+// matchBaseLines returns, for every line of base, the index of the same line
+// in other, or -1 when other deleted it.
+func matchBaseLines(base, other []string) []int {
+	match := make([]int, len(base))
+	for i := range match {
+		match[i] = -1
+	}
+
+	for _, e := range Lines(base, other) {
+		if e.Kind == OpEqual {
+			match[e.OldLine] = e.NewLine
+		}
+	}
+
+	return match
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func writeLines(out *strings.Builder, lines []string) {
+	for _, l := range lines {
+		out.WriteString(l)
+	}
+}
+
+// writeMarker writes a conflict marker on its own line, even when the chunk
+// before it has no trailing newline.
+func writeMarker(out *strings.Builder, marker string) {
+	s := out.String()
+	if len(s) > 0 && !strings.HasSuffix(s, "\n") {
+		out.WriteString("\n")
+	}
+	out.WriteString(marker + "\n")
+}
@@ -0,0 +1,98 @@
+package diff
+
+import "testing"
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		wantConflicts      int
+	}{
+		{
+			name:   "unchanged",
+			base:   "a\nb\nc\n",
+			ours:   "a\nb\nc\n",
+			theirs: "a\nb\nc\n",
+			want:   "a\nb\nc\n",
+		},
+		{
+			name:   "only ours changed",
+			base:   "a\nb\nc\n",
+			ours:   "a\nB\nc\n",
+			theirs: "a\nb\nc\n",
+			want:   "a\nB\nc\n",
+		},
+		{
+			name:   "only theirs changed",
+			base:   "a\nb\nc\n",
+			ours:   "a\nb\nc\n",
+			theirs: "a\nb\nC\n",
+			want:   "a\nb\nC\n",
+		},
+		{
+			name:   "both changed different lines",
+			base:   "a\nb\nc\nd\ne\n",
+			ours:   "A\nb\nc\nd\ne\n",
+			theirs: "a\nb\nc\nd\nE\n",
+			want:   "A\nb\nc\nd\nE\n",
+		},
+		{
+			name:   "insertions and deletions",
+			base:   "a\nb\nc\nd\ne\n",
+			ours:   "a\nours\nb\nc\nd\ne\n",
+			theirs: "a\nb\nc\ne\n",
+			want:   "a\nours\nb\nc\ne\n",
+		},
+		{
+			name:   "identical changes on both sides",
+			base:   "a\nb\nc\n",
+			ours:   "a\nx\ny\nc\n",
+			theirs: "a\nx\ny\nc\n",
+			want:   "a\nx\ny\nc\n",
+		},
+		{
+			name:          "overlapping changes",
+			base:          "a\nb\nc\n",
+			ours:          "a\nours\nc\n",
+			theirs:        "a\ntheirs\nc\n",
+			want:          "a\n<<<<<<< current\nours\n=======\ntheirs\n>>>>>>> generated\nc\n",
+			wantConflicts: 1,
+		},
+		{
+			name:          "conflicts without trailing newlines",
+			base:          "a\nb",
+			ours:          "a\nours",
+			theirs:        "a\ntheirs",
+			want:          "a\n<<<<<<< current\nours\n=======\ntheirs\n>>>>>>> generated\n",
+			wantConflicts: 1,
+		},
+		{
+			name:          "two conflicts",
+			base:          "a\nb\nc\nd\ne\n",
+			ours:          "a\nB1\nc\nD1\ne\n",
+			theirs:        "a\nB2\nc\nD2\ne\n",
+			want:          "a\n<<<<<<< current\nB1\n=======\nB2\n>>>>>>> generated\nc\n<<<<<<< current\nD1\n=======\nD2\n>>>>>>> generated\ne\n",
+			wantConflicts: 2,
+		},
+		{
+			name:   "empty base",
+			base:   "",
+			ours:   "",
+			theirs: "a\n",
+			want:   "a\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Merge3([]byte(tt.base), []byte(tt.ours), []byte(tt.theirs), "current", "generated")
+			if string(got.Content) != tt.want {
+				t.Errorf("Merge3() content =\n%s\nwant\n%s", got.Content, tt.want)
+			}
+			if got.Conflicts != tt.wantConflicts {
+				t.Errorf("Merge3() conflicts = %d, want %d", got.Conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package importer
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/pkg/errors"
+)
+
+type goImporter struct {
+	fset   *token.FileSet
+	result *Result
+	// structs holds every struct type declared in the package by name
+	structs map[string]*ast.StructType
+	// enums holds the named basic types that have constants declared
+	enums map[string]bool
+}
+
+var goBasicTypes = map[string]string{
+	"string":  "String",
+	"bool":    "Boolean",
+	"int":     "Int",
+	"int8":    "Int",
+	"int16":   "Int",
+	"int32":   "Int",
+	"int64":   "Int",
+	"uint":    "Int",
+	"uint8":   "Int",
+	"uint16":  "Int",
+	"uint32":  "Int",
+	"uint64":  "Int",
+	"float32": "Float",
+	"float64": "Float",
+}
+
+var goQualifiedTypes = map[string]string{
+	"time.Time":          "DateTime",
+	"primitive.ObjectID": "ID",
+}
+
+// ImportGo reads the exported structs of Go packages into codema models. Go
+// types are mapped back to codema types with the inverse of the mapGoType
+// template function, pointers become optional fields and struct tags become
+// directives.
+func ImportGo(paths []string) (*Result, error) {
+	result := &Result{}
+
+	var files []string
+	for _, path := range paths {
+		isDir, err := isDirectory(path)
+		if err != nil {
+			return nil, err
+		}
+		if !isDir {
+			files = append(files, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(path, "*.go"))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, m := range matches {
+			if !strings.HasSuffix(m, "_test.go") {
+				files = append(files, m)
+			}
+		}
+	}
+
+	imp := &goImporter{
+		fset:    token.NewFileSet(),
+		result:  result,
+		structs: make(map[string]*ast.StructType),
+		enums:   make(map[string]bool),
+	}
+
+	var parsed []*ast.File
+	for _, file := range files {
+		f, err := parser.ParseFile(imp.fset, file, nil, parser.ParseComments)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", file)
+		}
+		parsed = append(parsed, f)
+	}
+
+	for _, f := range parsed {
+		imp.collectTypes(f)
+	}
+	for _, f := range parsed {
+		imp.importFile(f)
+	}
+
+	result.AttachEnums()
+
+	return result, nil
+}
+
+func isDirectory(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return info.IsDir(), nil
+}
+
+// collectTypes records the structs of a file and turns named basic types
+// with constants into enums.
+func (imp *goImporter) collectTypes(f *ast.File) {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+
+		switch gen.Tok {
+		case token.TYPE:
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					imp.structs[ts.Name.Name] = st
+				}
+			}
+		case token.CONST:
+			imp.collectEnumValues(gen)
+		}
+	}
+}
+
+// collectEnumValues adds the constants of a const block to the enum of their
+// type. String constants contribute their value, others their name.
+func (imp *goImporter) collectEnumValues(gen *ast.GenDecl) {
+	var typeName string
+	for _, spec := range gen.Specs {
+		vs := spec.(*ast.ValueSpec)
+		if ident, ok := vs.Type.(*ast.Ident); ok {
+			typeName = ident.Name
+		} else if vs.Type != nil {
+			typeName = ""
+		}
+		if typeName == "" || goBasicTypes[typeName] != "" {
+			continue
+		}
+
+		for i, name := range vs.Names {
+			if !name.IsExported() {
+				continue
+			}
+			value := name.Name
+			if i < len(vs.Values) {
+				if lit, ok := vs.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					if s, err := strconv.Unquote(lit.Value); err == nil {
+						value = s
+					}
+				}
+			}
+			imp.addEnumValue(typeName, value)
+		}
+	}
+}
+
+func (imp *goImporter) addEnumValue(typeName, value string) {
+	for ex, en := range imp.result.Enums {
+		if en.Name == typeName {
+			imp.result.Enums[ex].Values = append(en.Values, value)
+			return
+		}
+	}
+
+	imp.enums[typeName] = true
+	imp.result.Enums = append(imp.result.Enums, config.EnumDefinition{
+		Name:   typeName,
+		Values: []string{value},
+	})
+}
+
+func (imp *goImporter) importFile(f *ast.File) {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok || !ts.Name.IsExported() {
+				continue
+			}
+			if ts.TypeParams != nil {
+				imp.result.Reportf("%s: generic struct %s is not supported and was skipped", imp.position(ts), ts.Name.Name)
+				continue
+			}
+
+			doc := ts.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+
+			model := NewModel(ts.Name.Name, commentText(doc))
+			model.Fields = imp.importFields(ts.Name.Name, st, map[string]bool{ts.Name.Name: true})
+			imp.result.Models = append(imp.result.Models, model)
+		}
+	}
+}
+
+// importFields returns the fields of a struct. Embedded structs of the same
+// package are flattened, seen guards against recursive embedding.
+func (imp *goImporter) importFields(modelName string, st *ast.StructType, seen map[string]bool) []config.FieldDefinition {
+	var fields []config.FieldDefinition
+
+	for _, f := range st.Fields.List {
+		tags := parseStructTag(f.Tag)
+
+		if len(f.Names) == 0 {
+			embedded := embeddedTypeName(f.Type)
+			if est, ok := imp.structs[embedded]; ok && !seen[embedded] {
+				seen[embedded] = true
+				fields = append(fields, imp.importFields(modelName, est, seen)...)
+				continue
+			}
+			imp.result.Reportf("%s: embedded field %s of %s is not supported and was skipped", imp.position(f), exprString(f.Type), modelName)
+			continue
+		}
+
+		for _, name := range f.Names {
+			if !name.IsExported() {
+				continue
+			}
+
+			fieldName := modelName + "." + name.Name
+			fieldType, optional, ok := imp.fieldType(fieldName, f.Type, f)
+			if !ok {
+				continue
+			}
+
+			description := commentText(f.Doc)
+			if description == "" {
+				description = commentText(f.Comment)
+			}
+
+			field := NewField(strcase.ToSnake(name.Name), fieldType, description, optional)
+			for _, key := range sortedTagKeys(tags) {
+				field.Directives = setDirective(field.Directives, key, tags[key])
+			}
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+func (imp *goImporter) fieldType(fieldName string, expr ast.Expr, node ast.Node) (string, bool, bool) {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		fieldType, _, ok := imp.fieldType(fieldName, t.X, node)
+		return fieldType, true, ok
+	case *ast.ArrayType:
+		if ident, ok := t.Elt.(*ast.Ident); ok && (ident.Name == "byte" || ident.Name == "uint8") {
+			imp.result.Reportf("%s: field %s of type []byte is not supported and was skipped", imp.position(node), fieldName)
+			return "", false, false
+		}
+		elemType, _, ok := imp.fieldType(fieldName, t.Elt, node)
+		if !ok {
+			return "", false, false
+		}
+		return "[" + elemType + "]", false, true
+	case *ast.Ident:
+		if basic, ok := goBasicTypes[t.Name]; ok {
+			return basic, false, true
+		}
+		if _, ok := imp.structs[t.Name]; ok {
+			return t.Name, false, true
+		}
+		if imp.enums[t.Name] {
+			return t.Name, false, true
+		}
+	case *ast.SelectorExpr:
+		if mapped, ok := goQualifiedTypes[exprString(t)]; ok {
+			return mapped, false, true
+		}
+	}
+
+	imp.result.Reportf("%s: field %s of type %s is not supported and was skipped", imp.position(node), fieldName, exprString(expr))
+
+	return "", false, false
+}
+
+func (imp *goImporter) position(node ast.Node) string {
+	return imp.fset.Position(node.Pos()).String()
+}
+
+func embeddedTypeName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+
+	return ""
+}
+
+func exprString(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.SelectorExpr:
+		return exprString(t.X) + "." + t.Sel.Name
+	case *ast.StarExpr:
+		return "*" + exprString(t.X)
+	case *ast.ArrayType:
+		return "[]" + exprString(t.Elt)
+	case *ast.MapType:
+		return "map[" + exprString(t.Key) + "]" + exprString(t.Value)
+	case *ast.InterfaceType:
+		return "interface{}"
+	default:
+		return "?"
+	}
+}
+
+func commentText(cg *ast.CommentGroup) string {
+	if cg == nil {
+		return ""
+	}
+
+	return strings.Join(strings.Fields(cg.Text()), " ")
+}
+
+// parseStructTag splits a struct tag into its keys and values.
+func parseStructTag(lit *ast.BasicLit) map[string]string {
+	if lit == nil {
+		return nil
+	}
+
+	raw, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return nil
+	}
+
+	tags := make(map[string]string)
+	tag := reflect.StructTag(raw)
+	for _, part := range strings.Fields(raw) {
+		key, _, found := strings.Cut(part, ":")
+		if !found {
+			continue
+		}
+		if value, ok := tag.Lookup(key); ok {
+			tags[key] = value
+		}
+	}
+
+	return tags
+}
+
+func sortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,7 @@
+package importer
+
+import "testing"
+
+func TestImportGo(t *testing.T) {
+	checkImport(t, ImportGo, "gostruct.go")
+}
@@ -0,0 +1,794 @@
+package importer
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/innovation-upstream/codema/internal/directive"
+	targetrenderer "github.com/innovation-upstream/codema/internal/target-renderer"
+	"github.com/pkg/errors"
+)
+
+type (
+	graphqlTokenKind int
+
+	graphqlToken struct {
+		kind  graphqlTokenKind
+		value string
+		line  int
+	}
+
+	graphqlParser struct {
+		file   string
+		tokens []graphqlToken
+		pos    int
+		result *Result
+		// scalars holds the custom scalars declared in the schema
+		scalars map[string]bool
+		// inputs are imported only when no object type exists that
+		// mapGraphQLInputType would derive them from
+		inputs []graphqlInput
+	}
+
+	graphqlInput struct {
+		file  string
+		model config.ModelDefinition
+	}
+
+	graphqlTypeRef struct {
+		name    string
+		list    bool
+		nonNull bool
+		// elem is the element type of a list
+		elem *graphqlTypeRef
+	}
+)
+
+const (
+	graphqlTokenEOF graphqlTokenKind = iota
+	graphqlTokenName
+	graphqlTokenString
+	graphqlTokenNumber
+	graphqlTokenPunct
+)
+
+var graphqlOperationTypes = map[string]bool{
+	"Query":        true,
+	"Mutation":     true,
+	"Subscription": true,
+}
+
+var graphqlDateTimeScalars = map[string]bool{
+	"DateTime":  true,
+	"Time":      true,
+	"Timestamp": true,
+}
+
+// ImportGraphQL reads GraphQL SDL files into codema models and enums. Fields
+// whose name or type would not render back to the original through
+// GetGraphqlNameForField and GetGraphqlTypeForField get a name or type mask
+// directive.
+func ImportGraphQL(paths []string) (*Result, error) {
+	result := &Result{}
+	p := &graphqlParser{
+		result:  result,
+		scalars: make(map[string]bool),
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		tokens, err := tokenizeGraphQL(string(data))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", path)
+		}
+
+		p.file = path
+		p.tokens = tokens
+		p.pos = 0
+		if err := p.parseDocument(); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", path)
+		}
+	}
+
+	for _, in := range p.inputs {
+		typeName := strings.TrimSuffix(in.model.Name, "Input")
+		if typ, ok := result.getModel(typeName); ok && graphqlInputMirrors(in.model, typ) {
+			result.Reportf("%s: input %s mirrors type %s and was not imported", in.file, in.model.Name, typeName)
+			continue
+		}
+		result.Models = append(result.Models, in.model)
+	}
+
+	p.resolveFieldTypes()
+	result.AttachEnums()
+
+	return result, nil
+}
+
+func tokenizeGraphQL(src string) ([]graphqlToken, error) {
+	var tokens []graphqlToken
+	line := 1
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], `"""`):
+			end := strings.Index(src[i+3:], `"""`)
+			if end < 0 {
+				return nil, errors.Errorf("line %d: unterminated block string", line)
+			}
+			body := src[i+3 : i+3+end]
+			tokens = append(tokens, graphqlToken{kind: graphqlTokenString, value: blockStringValue(body), line: line})
+			line += strings.Count(body, "\n")
+			i += end + 6
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) || src[j] != '"' {
+				return nil, errors.Errorf("line %d: unterminated string", line)
+			}
+			value, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				value = src[i+1 : j]
+			}
+			tokens = append(tokens, graphqlToken{kind: graphqlTokenString, value: value, line: line})
+			i = j + 1
+		case c == '_' || isASCIILetter(c):
+			j := i
+			for j < len(src) && (src[j] == '_' || isASCIILetter(src[j]) || isASCIIDigit(src[j])) {
+				j++
+			}
+			tokens = append(tokens, graphqlToken{kind: graphqlTokenName, value: src[i:j], line: line})
+			i = j
+		case c == '-' || isASCIIDigit(c):
+			j := i + 1
+			for j < len(src) && (isASCIIDigit(src[j]) || strings.IndexByte(".eE+-", src[j]) >= 0) {
+				j++
+			}
+			tokens = append(tokens, graphqlToken{kind: graphqlTokenNumber, value: src[i:j], line: line})
+			i = j
+		case strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, graphqlToken{kind: graphqlTokenPunct, value: "...", line: line})
+			i += 3
+		default:
+			tokens = append(tokens, graphqlToken{kind: graphqlTokenPunct, value: string(c), line: line})
+			i++
+		}
+	}
+
+	return append(tokens, graphqlToken{kind: graphqlTokenEOF, line: line}), nil
+}
+
+// blockStringValue removes the common indentation and surrounding blank lines
+// of a block string.
+func blockStringValue(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, `\"""`, `"""`), "\n")
+
+	indent := -1
+	for _, l := range lines[1:] {
+		trimmed := strings.TrimLeft(l, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(l) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if len(lines[i]) >= indent {
+			lines[i] = lines[i][indent:]
+		}
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isASCIIDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (p *graphqlParser) peek() graphqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *graphqlParser) next() graphqlToken {
+	t := p.tokens[p.pos]
+	if t.kind != graphqlTokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *graphqlParser) peekIs(value string) bool {
+	t := p.peek()
+	return t.kind == graphqlTokenPunct && t.value == value
+}
+
+func (p *graphqlParser) expect(value string) error {
+	t := p.next()
+	if t.value != value || t.kind == graphqlTokenString {
+		return errors.Errorf("line %d: expected %q but got %q", t.line, value, t.value)
+	}
+
+	return nil
+}
+
+func (p *graphqlParser) expectName() (string, error) {
+	t := p.next()
+	if t.kind != graphqlTokenName {
+		return "", errors.Errorf("line %d: expected a name but got %q", t.line, t.value)
+	}
+
+	return t.value, nil
+}
+
+// skipBalanced skips a block opened by the current token, e.g. arguments or a
+// field list.
+func (p *graphqlParser) skipBalanced(open, close string) {
+	depth := 0
+	for {
+		t := p.next()
+		if t.kind == graphqlTokenEOF {
+			return
+		}
+		if t.kind != graphqlTokenPunct {
+			continue
+		}
+		switch t.value {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+func (p *graphqlParser) parseDocument() error {
+	for p.peek().kind != graphqlTokenEOF {
+		var description string
+		if p.peek().kind == graphqlTokenString {
+			description = p.next().value
+		}
+
+		keyword, err := p.expectName()
+		if err != nil {
+			return err
+		}
+
+		switch keyword {
+		case "type":
+			err = p.parseObject(description, false)
+		case "input":
+			err = p.parseObject(description, true)
+		case "enum":
+			err = p.parseEnum(description)
+		case "scalar":
+			var name string
+			name, err = p.expectName()
+			p.skipDirectives()
+			p.scalars[name] = true
+		case "interface", "union":
+			var name string
+			name, err = p.expectName()
+			p.result.Reportf("%s: %s %s has no codema equivalent and was skipped", p.file, keyword, name)
+			p.skipDefinition()
+		case "schema":
+			p.result.Reportf("%s: schema definitions are not imported", p.file)
+			p.skipDefinition()
+		case "extend":
+			err = p.skipExtension()
+		case "directive":
+			p.skipDirectiveDefinition()
+		default:
+			return errors.Errorf("line %d: unexpected %q", p.peek().line, keyword)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// skipDefinition skips the rest of a definition up to the next top level
+// keyword or description.
+func (p *graphqlParser) skipDefinition() {
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == graphqlTokenEOF, t.kind == graphqlTokenString:
+			return
+		case t.kind == graphqlTokenPunct && t.value == "{":
+			p.skipBalanced("{", "}")
+			return
+		case t.kind == graphqlTokenPunct && t.value == "(":
+			p.skipBalanced("(", ")")
+		case t.kind == graphqlTokenName && isGraphQLDefinitionKeyword(t.value):
+			return
+		default:
+			p.next()
+		}
+	}
+}
+
+// skipExtension skips an extension with the definition it extends, so that
+// extend type User { ... } is not read as another User.
+func (p *graphqlParser) skipExtension() error {
+	kind, err := p.expectName()
+	if err != nil {
+		return err
+	}
+
+	if kind == "schema" {
+		p.result.Reportf("%s: extend schema is not imported", p.file)
+		p.skipDefinition()
+		return nil
+	}
+
+	name, err := p.expectName()
+	if err != nil {
+		return err
+	}
+	p.result.Reportf("%s: extend %s %s is not imported", p.file, kind, name)
+	p.skipDefinition()
+
+	return nil
+}
+
+func (p *graphqlParser) skipDirectiveDefinition() {
+	p.next() // @
+	p.next() // name
+	if p.peekIs("(") {
+		p.skipBalanced("(", ")")
+	}
+	for {
+		t := p.peek()
+		if t.kind == graphqlTokenPunct && t.value == "|" {
+			p.next()
+			continue
+		}
+		if t.kind != graphqlTokenName || (isGraphQLDefinitionKeyword(t.value) && t.value != "on") {
+			return
+		}
+		p.next()
+	}
+}
+
+func isGraphQLDefinitionKeyword(name string) bool {
+	switch name {
+	case "type", "input", "enum", "scalar", "interface", "union", "schema", "extend", "directive":
+		return true
+	}
+
+	return false
+}
+
+func (p *graphqlParser) skipDirectives() {
+	for p.peekIs("@") {
+		p.next()
+		p.next()
+		if p.peekIs("(") {
+			p.skipBalanced("(", ")")
+		}
+	}
+}
+
+// parseDirectives reads directive usages into codema directives. A directive
+// without arguments becomes true, otherwise a map of its arguments.
+func (p *graphqlParser) parseDirectives() (map[string]interface{}, error) {
+	var directives map[string]interface{}
+	for p.peekIs("@") {
+		p.next()
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+
+		var value interface{} = true
+		if p.peekIs("(") {
+			p.next()
+			args := make(map[string]interface{})
+			for !p.peekIs(")") {
+				argName, err := p.expectName()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				args[argName], err = p.parseValue()
+				if err != nil {
+					return nil, err
+				}
+			}
+			p.next()
+			value = args
+		}
+
+		if directives == nil {
+			directives = make(map[string]interface{})
+		}
+		directives[name] = value
+	}
+
+	return directives, nil
+}
+
+func (p *graphqlParser) parseValue() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case graphqlTokenString:
+		return t.value, nil
+	case graphqlTokenNumber:
+		if i, err := strconv.ParseInt(t.value, 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, errors.Errorf("line %d: invalid number %s", t.line, t.value)
+		}
+		return f, nil
+	case graphqlTokenName:
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		// Enum values are kept as strings
+		return t.value, nil
+	case graphqlTokenPunct:
+		switch t.value {
+		case "[":
+			list := []interface{}{}
+			for !p.peekIs("]") {
+				if p.peek().kind == graphqlTokenEOF {
+					return nil, errors.Errorf("line %d: unterminated list", t.line)
+				}
+				v, err := p.parseValue()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			p.next()
+			return list, nil
+		case "{":
+			obj := make(map[string]interface{})
+			for !p.peekIs("}") {
+				name, err := p.expectName()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				obj[name], err = p.parseValue()
+				if err != nil {
+					return nil, err
+				}
+			}
+			p.next()
+			return obj, nil
+		}
+	}
+
+	return nil, errors.Errorf("line %d: unexpected %q", t.line, t.value)
+}
+
+func (p *graphqlParser) parseTypeRef() (*graphqlTypeRef, error) {
+	var ref *graphqlTypeRef
+	if p.peekIs("[") {
+		p.next()
+		elem, err := p.parseTypeRef()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		ref = &graphqlTypeRef{list: true, elem: elem}
+	} else {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		ref = &graphqlTypeRef{name: name}
+	}
+
+	if p.peekIs("!") {
+		p.next()
+		ref.nonNull = true
+	}
+
+	return ref, nil
+}
+
+func (ref *graphqlTypeRef) String() string {
+	s := ref.name
+	if ref.list {
+		s = "[" + ref.elem.String() + "]"
+	}
+	if ref.nonNull {
+		s += "!"
+	}
+
+	return s
+}
+
+func (p *graphqlParser) parseObject(description string, isInput bool) error {
+	name, err := p.expectName()
+	if err != nil {
+		return err
+	}
+
+	if p.peek().kind == graphqlTokenName && p.peek().value == "implements" {
+		p.next()
+		for p.peek().kind == graphqlTokenName || p.peekIs("&") {
+			if p.peek().kind == graphqlTokenName && isGraphQLDefinitionKeyword(p.peek().value) {
+				break
+			}
+			p.next()
+		}
+	}
+
+	directives, err := p.parseDirectives()
+	if err != nil {
+		return err
+	}
+
+	if graphqlOperationTypes[name] {
+		p.result.Reportf("%s: operation type %s was skipped", p.file, name)
+		if p.peekIs("{") {
+			p.skipBalanced("{", "}")
+		}
+		return nil
+	}
+
+	model := NewModel(name, description)
+	model.Directives = directives
+
+	if p.peekIs("{") {
+		p.next()
+		for !p.peekIs("}") {
+			if p.peek().kind == graphqlTokenEOF {
+				return errors.Errorf("unexpected end of file in %s", name)
+			}
+			field, err := p.parseField(name)
+			if err != nil {
+				return err
+			}
+			model.Fields = append(model.Fields, field)
+		}
+		p.next()
+	}
+
+	if isInput {
+		p.inputs = append(p.inputs, graphqlInput{file: p.file, model: model})
+		return nil
+	}
+
+	p.result.Models = append(p.result.Models, model)
+
+	return nil
+}
+
+// parseField reads a field definition. The codema type is resolved later,
+// since the field may reference types declared further down; until then
+// Type holds the GraphQL type.
+func (p *graphqlParser) parseField(typeName string) (config.FieldDefinition, error) {
+	var description string
+	if p.peek().kind == graphqlTokenString {
+		description = p.next().value
+	}
+
+	name, err := p.expectName()
+	if err != nil {
+		return config.FieldDefinition{}, err
+	}
+
+	if p.peekIs("(") {
+		p.result.Reportf("%s: arguments of %s.%s have no codema equivalent and were skipped", p.file, typeName, name)
+		p.skipBalanced("(", ")")
+	}
+
+	if err := p.expect(":"); err != nil {
+		return config.FieldDefinition{}, err
+	}
+
+	ref, err := p.parseTypeRef()
+	if err != nil {
+		return config.FieldDefinition{}, err
+	}
+
+	// Default values of input fields are not part of the model
+	if p.peekIs("=") {
+		p.next()
+		if _, err := p.parseValue(); err != nil {
+			return config.FieldDefinition{}, err
+		}
+	}
+
+	directives, err := p.parseDirectives()
+	if err != nil {
+		return config.FieldDefinition{}, err
+	}
+
+	field := NewField(strcase.ToSnake(name), ref.String(), description, !ref.nonNull)
+	field.Directives = directives
+	if targetrenderer.GetGraphqlNameForField(field) != name {
+		field.Directives = setDirective(field.Directives, directive.WellKnownDirectiveGraphQLFieldNameMask, name)
+	}
+
+	return field, nil
+}
+
+func (p *graphqlParser) parseEnum(description string) error {
+	name, err := p.expectName()
+	if err != nil {
+		return err
+	}
+	p.skipDirectives()
+
+	enum := config.EnumDefinition{
+		Name:        name,
+		Description: description,
+	}
+
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.peekIs("}") {
+		t := p.next()
+		switch t.kind {
+		case graphqlTokenEOF:
+			return errors.Errorf("unexpected end of file in enum %s", name)
+		case graphqlTokenString:
+			// Value descriptions have no codema equivalent
+		case graphqlTokenName:
+			enum.Values = append(enum.Values, t.value)
+			p.skipDirectives()
+		default:
+			return errors.Errorf("line %d: unexpected %q in enum %s", t.line, t.value, name)
+		}
+	}
+	p.next()
+
+	p.result.Enums = append(p.result.Enums, enum)
+
+	return nil
+}
+
+// resolveFieldTypes maps the GraphQL type held by every field to a codema
+// type, adding a type mask where the codema type would render differently.
+func (p *graphqlParser) resolveFieldTypes() {
+	for mx := range p.result.Models {
+		model := &p.result.Models[mx]
+		for fx := range model.Fields {
+			field := &model.Fields[fx]
+			graphqlType := strings.TrimSuffix(field.Type, "!")
+			field.Type = p.codemaType(graphqlType, model.Name+"."+field.Name)
+
+			if targetrenderer.GetGraphqlTypeForField(*field) != graphqlType {
+				field.Directives = setDirective(field.Directives, directive.WellKnownDirectiveGraphQLTypeNameMask, graphqlType)
+			}
+		}
+	}
+}
+
+func (p *graphqlParser) codemaType(graphqlType, fieldName string) string {
+	graphqlType = strings.TrimSuffix(graphqlType, "!")
+	if strings.HasPrefix(graphqlType, "[") && strings.HasSuffix(graphqlType, "]") {
+		return "[" + p.codemaType(graphqlType[1:len(graphqlType)-1], fieldName) + "]"
+	}
+
+	switch graphqlType {
+	case "ID", "String", "Int", "Float", "Boolean":
+		return graphqlType
+	}
+
+	if p.scalars[graphqlType] {
+		if graphqlDateTimeScalars[graphqlType] {
+			return "DateTime"
+		}
+		p.result.Reportf("field %s uses custom scalar %s, which was mapped to String", fieldName, graphqlType)
+		return "String"
+	}
+
+	if p.result.HasModel(graphqlType) {
+		return graphqlType
+	}
+	if _, ok := p.result.GetEnumByName(graphqlType); ok {
+		return graphqlType
+	}
+	// Inputs mirroring a type are referenced through the type
+	if typeName := strings.TrimSuffix(graphqlType, "Input"); p.result.HasModel(typeName) {
+		return typeName
+	}
+
+	p.result.Reportf("field %s references %s, which was not imported", fieldName, graphqlType)
+
+	return graphqlType
+}
+
+// graphqlInputMirrors tells whether input has the fields of typ, with the
+// types mapGraphQLInputType would give them. Field types still hold the
+// GraphQL types.
+func graphqlInputMirrors(input, typ config.ModelDefinition) bool {
+	if len(input.Fields) != len(typ.Fields) {
+		return false
+	}
+
+	for _, tf := range typ.Fields {
+		var found bool
+		for _, inf := range input.Fields {
+			if inf.Name == tf.Name {
+				found = inf.Optional == tf.Optional && graphqlInputTypeMirrors(inf.Type, tf.Type)
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func graphqlInputTypeMirrors(inputType, typeType string) bool {
+	inputType = strings.TrimSuffix(inputType, "!")
+	typeType = strings.TrimSuffix(typeType, "!")
+
+	inputList := strings.HasPrefix(inputType, "[") && strings.HasSuffix(inputType, "]")
+	typeList := strings.HasPrefix(typeType, "[") && strings.HasSuffix(typeType, "]")
+	switch {
+	case inputList && typeList:
+		return graphqlInputTypeMirrors(inputType[1:len(inputType)-1], typeType[1:len(typeType)-1])
+	case inputList || typeList:
+		return false
+	}
+
+	return inputType == typeType ||
+		(typeType == "ID" && inputType == "String") ||
+		inputType == typeType+"Input"
+}
+
+func setDirective(directives map[string]interface{}, name string, value interface{}) map[string]interface{} {
+	if directives == nil {
+		directives = make(map[string]interface{})
+	}
+	directives[name] = value
+
+	return directives
+}
@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"testing"
+
+	targetrenderer "github.com/innovation-upstream/codema/internal/target-renderer"
+)
+
+func TestImportGraphQL(t *testing.T) {
+	checkImport(t, ImportGraphQL, "graphql.graphql")
+}
+
+// TestImportGraphQLRoundTrip checks that every imported field renders back
+// to its name and type in the SDL, the outer non-null aside, which is the
+// optional flag of the field.
+func TestImportGraphQLRoundTrip(t *testing.T) {
+	want := map[string]map[string]string{
+		"Order": {
+			"id":        "ID",
+			"createdAt": "DateTime",
+			"userID":    "String",
+			"tags":      "[String!]",
+			"status":    "OrderStatus",
+			"items":     "[Item]",
+			"metadata":  "JSON",
+			"total":     "Float",
+		},
+		"Item": {
+			"sku":      "String",
+			"quantity": "Int",
+		},
+		"OrderFilter": {
+			"status":      "OrderStatus",
+			"placedAfter": "DateTime",
+		},
+	}
+
+	result, err := ImportGraphQL([]string{"testdata/graphql.graphql"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, model := range result.Models {
+		fields, ok := want[model.Name]
+		if !ok {
+			t.Errorf("unexpected model %s", model.Name)
+			continue
+		}
+		if len(model.Fields) != len(fields) {
+			t.Errorf("model %s has %d fields, want %d", model.Name, len(model.Fields), len(fields))
+		}
+
+		for _, f := range model.Fields {
+			name := targetrenderer.GetGraphqlNameForField(f)
+			wantType, ok := fields[name]
+			if !ok {
+				t.Errorf("field %s.%s renders as unexpected name %s", model.Name, f.Name, name)
+				continue
+			}
+			if got := targetrenderer.GetGraphqlTypeForField(f); got != wantType {
+				t.Errorf("field %s.%s renders as type %s, want %s", model.Name, name, got, wantType)
+			}
+		}
+		delete(want, model.Name)
+	}
+
+	for name := range want {
+		t.Errorf("model %s was not imported", name)
+	}
+}
@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/innovation-upstream/codema/internal/convert"
+)
+
+type (
+	// Result holds the models and enums read from an external schema, and a
+	// report of everything that could not be mapped to codema.
+	Result struct {
+		Models []config.ModelDefinition
+		Enums  []config.EnumDefinition
+		Report []string
+	}
+)
+
+func (r *Result) Reportf(format string, args ...interface{}) {
+	r.Report = append(r.Report, fmt.Sprintf(format, args...))
+}
+
+func (r *Result) GetEnumByName(name string) (config.EnumDefinition, bool) {
+	for _, en := range r.Enums {
+		if en.Name == name {
+			return en, true
+		}
+	}
+
+	return config.EnumDefinition{}, false
+}
+
+func (r *Result) HasModel(name string) bool {
+	_, ok := r.getModel(name)
+	return ok
+}
+
+func (r *Result) getModel(name string) (config.ModelDefinition, bool) {
+	for _, m := range r.Models {
+		if m.Name == name {
+			return m, true
+		}
+	}
+
+	return config.ModelDefinition{}, false
+}
+
+// AttachEnums copies every enum a model's fields reference into the model,
+// since codema only resolves enum field types against the model's own enums.
+func (r *Result) AttachEnums() {
+	for mx, m := range r.Models {
+		for _, f := range m.Fields {
+			enumName := ElementType(f.Type)
+			en, ok := r.GetEnumByName(enumName)
+			if !ok || modelHasEnum(m, enumName) {
+				continue
+			}
+			m.Enums = append(m.Enums, en)
+		}
+		r.Models[mx] = m
+	}
+}
+
+// ToStarlark renders the result as Starlark definitions, prefixed with a
+// comment naming the sources.
+func (r *Result) ToStarlark(sources []string) ([]byte, error) {
+	content, err := convert.ModelsToStarlark(r.Models, r.Enums)
+	if err != nil {
+		return nil, err
+	}
+
+	header := "# Imported by codema from " + strings.Join(sources, ", ") + "\n\n"
+
+	return append([]byte(header), content...), nil
+}
+
+func modelHasEnum(m config.ModelDefinition, name string) bool {
+	for _, en := range m.Enums {
+		if en.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ElementType strips the list brackets from a codema field type.
+func ElementType(fieldType string) string {
+	for strings.HasPrefix(fieldType, "[") && strings.HasSuffix(fieldType, "]") {
+		fieldType = fieldType[1 : len(fieldType)-1]
+	}
+
+	return fieldType
+}
+
+func NewModel(name, description string) config.ModelDefinition {
+	return config.ModelDefinition{
+		Name:               name,
+		NameKebab:          strcase.ToKebab(name),
+		NameCamel:          strcase.ToCamel(name),
+		NameLowerCamel:     strcase.ToLowerCamel(name),
+		NameScreaming:      strcase.ToScreamingSnake(name),
+		NameScreamingSnake: strcase.ToScreamingSnake(name),
+		NameSnake:          strcase.ToSnake(name),
+		Description:        description,
+	}
+}
+
+func NewField(name, fieldType, description string, optional bool) config.FieldDefinition {
+	return config.FieldDefinition{
+		Name:               name,
+		NameKebab:          strcase.ToKebab(name),
+		NameCamel:          strcase.ToCamel(name),
+		NameLowerCamel:     strcase.ToLowerCamel(name),
+		NameScreaming:      strcase.ToScreamingSnake(name),
+		NameScreamingSnake: strcase.ToScreamingSnake(name),
+		NameSnake:          strcase.ToSnake(name),
+		Type:               fieldType,
+		Description:        description,
+		Optional:           optional,
+	}
+}
@@ -0,0 +1,59 @@
+package importer
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the importer tests")
+
+// checkImport imports a fixture of testdata, and compares the Starlark
+// definitions and the report with the .star and .report golden files named
+// after it.
+func checkImport(t *testing.T, importFn func([]string) (*Result, error), fixture string) *Result {
+	t.Helper()
+
+	path := filepath.Join("testdata", fixture)
+	result, err := importFn([]string{path})
+	if err != nil {
+		t.Fatalf("importing %s: %v", path, err)
+	}
+
+	content, err := result.ToStarlark([]string{path})
+	if err != nil {
+		t.Fatalf("rendering %s: %v", path, err)
+	}
+
+	golden := strings.TrimSuffix(path, filepath.Ext(path))
+	checkGolden(t, golden+".star", string(content))
+
+	var report strings.Builder
+	for _, r := range result.Report {
+		report.WriteString(r + "\n")
+	}
+	checkGolden(t, golden+".report", report.String())
+
+	return result
+}
+
+func checkGolden(t *testing.T, path, got string) {
+	t.Helper()
+
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the output, rerun with -update to accept it:\n%s", path, got)
+	}
+}
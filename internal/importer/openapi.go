@@ -0,0 +1,429 @@
+package importer
+
+import (
+	"os"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v3"
+)
+
+type (
+	openapiImporter struct {
+		file   string
+		result *Result
+		// schemas are the maps of named schemas found in the document
+		schemas []openapiSchemas
+	}
+
+	openapiSchemas struct {
+		// refPrefix is the prefix of local references to the schemas
+		refPrefix string
+		schemas   *yaml.Node
+	}
+)
+
+var openapiUnsupportedKeywords = []string{"oneOf", "anyOf", "not", "patternProperties"}
+
+// ImportOpenAPI reads the component schemas of OpenAPI documents, or the
+// definitions of JSON Schema documents, into codema models and enums.
+func ImportOpenAPI(paths []string) (*Result, error) {
+	result := &Result{}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		// Nodes keep schemas and properties in document order, and keys and
+		// enum values as written
+		var root yaml.Node
+		err = yaml.Unmarshal(data, &root)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", path)
+		}
+		var doc *yaml.Node
+		if len(root.Content) > 0 {
+			doc = asMap(root.Content[0])
+		}
+		if doc == nil {
+			return nil, errors.Errorf("%s is not a YAML or JSON object", path)
+		}
+
+		imp := &openapiImporter{
+			file:   path,
+			result: result,
+		}
+		if err := imp.importDocument(doc); err != nil {
+			return nil, errors.Wrapf(err, "failed to import %s", path)
+		}
+	}
+
+	result.AttachEnums()
+
+	return result, nil
+}
+
+func (imp *openapiImporter) importDocument(doc *yaml.Node) error {
+	// Documents may hold several of them, like definitions kept next to
+	// $defs while migrating to a newer JSON Schema draft
+	if schemas := asMap(mapValue(asMap(mapValue(doc, "components")), "schemas")); schemas != nil {
+		imp.schemas = append(imp.schemas, openapiSchemas{refPrefix: "#/components/schemas/", schemas: schemas})
+	}
+	if schemas := asMap(mapValue(doc, "definitions")); schemas != nil {
+		imp.schemas = append(imp.schemas, openapiSchemas{refPrefix: "#/definitions/", schemas: schemas})
+	}
+	if schemas := asMap(mapValue(doc, "$defs")); schemas != nil {
+		imp.schemas = append(imp.schemas, openapiSchemas{refPrefix: "#/$defs/", schemas: schemas})
+	}
+
+	if imp.schemas == nil {
+		// A plain JSON Schema describing a single object
+		title := stringValue(mapValue(doc, "title"))
+		if title == "" || mapValue(doc, "properties") == nil {
+			return errors.New("no components.schemas, definitions or $defs found")
+		}
+		imp.importSchema(strcase.ToCamel(title), doc)
+		return nil
+	}
+
+	for _, set := range imp.schemas {
+		for _, item := range mapItems(set.schemas) {
+			name := item.key
+			schema := asMap(item.value)
+			if schema == nil {
+				imp.result.Reportf("%s: schema %s is not an object and was skipped", imp.file, name)
+				continue
+			}
+			imp.importSchema(schemaTypeName(name), schema)
+		}
+	}
+
+	return nil
+}
+
+// importSchema imports a named schema as a model or enum.
+func (imp *openapiImporter) importSchema(name string, schema *yaml.Node) {
+	description := stringValue(mapValue(schema, "description"))
+
+	if values := mapValue(schema, "enum"); values != nil {
+		imp.importEnum(name, description, values)
+		return
+	}
+
+	schemaType, _ := typeOfSchema(schema)
+	hasProperties := mapValue(schema, "properties") != nil || mapValue(schema, "allOf") != nil
+	if schemaType != "object" && !hasProperties {
+		imp.result.Reportf("%s: schema %s of type %q is not an object or enum and was skipped", imp.file, name, schemaType)
+		return
+	}
+
+	model := NewModel(name, description)
+	if boolValue(mapValue(schema, "deprecated")) {
+		model.Directives = setDirective(model.Directives, "deprecated", true)
+	}
+
+	// Reserve the position of the model before inline models are added
+	idx := len(imp.result.Models)
+	imp.result.Models = append(imp.result.Models, model)
+
+	model.Fields = imp.importProperties(name, schema)
+	imp.result.Models[idx].Fields = model.Fields
+}
+
+func (imp *openapiImporter) importEnum(name, description string, values *yaml.Node) {
+	enum := config.EnumDefinition{
+		Name:        name,
+		Description: description,
+	}
+	for _, v := range asList(values) {
+		if v.Kind != yaml.ScalarNode || v.Tag == "!!null" {
+			continue
+		}
+		enum.Values = append(enum.Values, v.Value)
+	}
+
+	imp.result.Enums = append(imp.result.Enums, enum)
+}
+
+// importProperties returns the fields of an object schema, merging the
+// properties of every allOf part.
+func (imp *openapiImporter) importProperties(modelName string, schema *yaml.Node) []config.FieldDefinition {
+	var fields []config.FieldDefinition
+
+	for _, part := range asList(mapValue(schema, "allOf")) {
+		partSchema := imp.resolveRef(asMap(part))
+		if partSchema == nil {
+			imp.result.Reportf("%s: allOf part of %s could not be resolved and was skipped", imp.file, modelName)
+			continue
+		}
+		fields = append(fields, imp.importProperties(modelName, partSchema)...)
+	}
+
+	for _, keyword := range openapiUnsupportedKeywords {
+		if mapValue(schema, keyword) != nil {
+			imp.result.Reportf("%s: %s of %s is not supported and was skipped", imp.file, keyword, modelName)
+		}
+	}
+	if additional := mapValue(schema, "additionalProperties"); additional != nil && !isFalse(additional) {
+		imp.result.Reportf("%s: additionalProperties of %s is not supported, only the declared properties were imported", imp.file, modelName)
+	}
+
+	required := make(map[string]bool)
+	for _, r := range asList(mapValue(schema, "required")) {
+		required[r.Value] = true
+	}
+
+	for _, item := range mapItems(mapValue(schema, "properties")) {
+		propName := item.key
+		prop := asMap(item.value)
+
+		fieldType, ok := imp.fieldType(modelName, propName, prop)
+		if !ok {
+			continue
+		}
+
+		description := stringValue(mapValue(prop, "description"))
+		nullable := boolValue(mapValue(prop, "nullable"))
+		if _, nullType := typeOfSchema(prop); nullType {
+			nullable = true
+		}
+		field := NewField(propName, fieldType, description, !required[propName] || nullable)
+		if boolValue(mapValue(prop, "deprecated")) {
+			field.Directives = setDirective(field.Directives, "deprecated", true)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// fieldType maps a property schema to a codema type, importing inline
+// objects and enums as models and enums named after the property.
+func (imp *openapiImporter) fieldType(modelName, propName string, prop *yaml.Node) (string, bool) {
+	fieldName := modelName + "." + propName
+
+	if ref := stringValue(mapValue(prop, "$ref")); ref != "" {
+		name, _, ok := imp.refSchema(ref)
+		if !ok {
+			imp.result.Reportf("%s: field %s references %s, only local schema references are supported", imp.file, fieldName, ref)
+			return "", false
+		}
+		return schemaTypeName(name), true
+	}
+
+	for _, keyword := range openapiUnsupportedKeywords {
+		if mapValue(prop, keyword) != nil {
+			imp.result.Reportf("%s: field %s uses %s, which is not supported, and was skipped", imp.file, fieldName, keyword)
+			return "", false
+		}
+	}
+
+	if allOf := asList(mapValue(prop, "allOf")); len(allOf) == 1 {
+		// allOf with a single reference is commonly used to attach a description
+		return imp.fieldType(modelName, propName, asMap(allOf[0]))
+	}
+
+	inlineName := modelName + strcase.ToCamel(propName)
+	if mapValue(prop, "enum") != nil {
+		description := stringValue(mapValue(prop, "description"))
+		imp.importEnum(inlineName, description, mapValue(prop, "enum"))
+		return inlineName, true
+	}
+
+	propType, _ := typeOfSchema(prop)
+	format := stringValue(mapValue(prop, "format"))
+	switch propType {
+	case "string":
+		switch format {
+		case "date-time":
+			return "DateTime", true
+		case "", "uuid", "email", "uri", "hostname", "password":
+			return "String", true
+		default:
+			imp.result.Reportf("%s: field %s has format %s, which was mapped to String", imp.file, fieldName, format)
+			return "String", true
+		}
+	case "integer":
+		return "Int", true
+	case "number":
+		return "Float", true
+	case "boolean":
+		return "Boolean", true
+	case "array":
+		items := asMap(mapValue(prop, "items"))
+		if items == nil {
+			imp.result.Reportf("%s: array field %s has no items schema and was skipped", imp.file, fieldName)
+			return "", false
+		}
+		itemType, ok := imp.fieldType(modelName, propName, items)
+		if !ok {
+			return "", false
+		}
+		return "[" + itemType + "]", true
+	case "object", "":
+		if mapValue(prop, "properties") == nil {
+			if mapValue(prop, "additionalProperties") != nil {
+				imp.result.Reportf("%s: field %s is a map (additionalProperties), which is not supported, and was skipped", imp.file, fieldName)
+			} else {
+				imp.result.Reportf("%s: field %s has no type and was skipped", imp.file, fieldName)
+			}
+			return "", false
+		}
+		imp.importSchema(inlineName, prop)
+		return inlineName, true
+	default:
+		imp.result.Reportf("%s: field %s has unsupported type %s and was skipped", imp.file, fieldName, propType)
+		return "", false
+	}
+}
+
+func (imp *openapiImporter) resolveRef(schema *yaml.Node) *yaml.Node {
+	ref := stringValue(mapValue(schema, "$ref"))
+	if ref == "" {
+		return schema
+	}
+	_, schema, _ = imp.refSchema(ref)
+
+	return schema
+}
+
+// refSchema looks up the schema a local reference points to, returning its
+// name.
+func (imp *openapiImporter) refSchema(ref string) (string, *yaml.Node, bool) {
+	for _, set := range imp.schemas {
+		if strings.HasPrefix(ref, set.refPrefix) {
+			name := strings.TrimPrefix(ref, set.refPrefix)
+			return name, asMap(mapValue(set.schemas, name)), true
+		}
+	}
+
+	return "", nil, false
+}
+
+// typeOfSchema returns the type of a schema, and whether it is nullable by
+// its type. JSON Schema and OpenAPI 3.1 write nullable types as a list like
+// ["string", "null"]; other lists of types are returned joined, which no type
+// matches.
+func typeOfSchema(schema *yaml.Node) (string, bool) {
+	t := mapValue(schema, "type")
+	if t == nil {
+		return "", false
+	}
+
+	switch t.Kind {
+	case yaml.ScalarNode:
+		return t.Value, false
+	case yaml.SequenceNode:
+		var types []string
+		var nullable bool
+		for _, member := range t.Content {
+			if member.Value == "null" {
+				nullable = true
+				continue
+			}
+			types = append(types, member.Value)
+		}
+		return strings.Join(types, ", "), nullable
+	}
+
+	return "", false
+}
+
+// schemaTypeName turns a schema name such as booking.Booking or
+// booking-status into a codema type name.
+func schemaTypeName(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+
+	return strcase.ToCamel(name)
+}
+
+type openapiItem struct {
+	key   string
+	value *yaml.Node
+}
+
+// mapItems returns the items of a mapping node in document order, with keys
+// as written.
+func mapItems(m *yaml.Node) []openapiItem {
+	m = asMap(m)
+	if m == nil {
+		return nil
+	}
+
+	var items []openapiItem
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		items = append(items, openapiItem{key: m.Content[i].Value, value: resolveAlias(m.Content[i+1])})
+	}
+
+	return items
+}
+
+func mapValue(m *yaml.Node, key string) *yaml.Node {
+	for _, item := range mapItems(m) {
+		if item.key == key {
+			return item.value
+		}
+	}
+
+	return nil
+}
+
+func asMap(n *yaml.Node) *yaml.Node {
+	n = resolveAlias(n)
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	return n
+}
+
+func asList(n *yaml.Node) []*yaml.Node {
+	n = resolveAlias(n)
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	var items []*yaml.Node
+	for _, item := range n.Content {
+		items = append(items, resolveAlias(item))
+	}
+
+	return items
+}
+
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+
+	return n
+}
+
+// stringValue returns the value of a string scalar, or "" for other nodes.
+func stringValue(n *yaml.Node) string {
+	if n == nil || n.Kind != yaml.ScalarNode || n.Tag != "!!str" {
+		return ""
+	}
+
+	return n.Value
+}
+
+func boolValue(n *yaml.Node) bool {
+	var b bool
+	if n == nil || n.Kind != yaml.ScalarNode || n.Tag != "!!bool" || n.Decode(&b) != nil {
+		return false
+	}
+
+	return b
+}
+
+func isFalse(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.Tag == "!!bool" && !boolValue(n)
+}
@@ -0,0 +1,7 @@
+package importer
+
+import "testing"
+
+func TestImportOpenAPI(t *testing.T) {
+	checkImport(t, ImportOpenAPI, "openapi.yaml")
+}
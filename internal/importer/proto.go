@@ -0,0 +1,468 @@
+package importer
+
+import (
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/pkg/errors"
+)
+
+type (
+	protoToken struct {
+		value string
+		// comment is the comment block directly above the token
+		comment string
+		line    int
+	}
+
+	protoParser struct {
+		file   string
+		tokens []protoToken
+		pos    int
+		result *Result
+		// scope is the name prefix of the message currently being parsed
+		scope []string
+		// fields holds the raw type of every parsed field, resolved once all
+		// messages and enums are known
+		fields []protoPendingField
+	}
+
+	protoPendingField struct {
+		model     int
+		field     int
+		typeName  string
+		scope     []string
+		repeated  bool
+		fieldName string
+	}
+)
+
+var protoScalarTypes = map[string]string{
+	"string":   "String",
+	"int64":    "Int",
+	"int32":    "Int",
+	"sint32":   "Int",
+	"sint64":   "Int",
+	"sfixed32": "Int",
+	"sfixed64": "Int",
+	"uint32":   "Int",
+	"fixed32":  "Int",
+	"uint64":   "Int",
+	"fixed64":  "Int",
+	"double":   "Float",
+	"float":    "Float",
+	"bool":     "Boolean",
+}
+
+var protoWellKnownTypes = map[string]string{
+	"google.protobuf.Timestamp":   "DateTime",
+	"google.protobuf.StringValue": "String",
+	"google.protobuf.Int64Value":  "Int",
+	"google.protobuf.Int32Value":  "Int",
+	"google.protobuf.UInt32Value": "Int",
+	"google.protobuf.DoubleValue": "Float",
+	"google.protobuf.FloatValue":  "Float",
+	"google.protobuf.BoolValue":   "Boolean",
+}
+
+// ImportProto reads proto files into codema models and enums. Proto types are
+// mapped back to codema types with the inverse of the protoType template
+// function.
+func ImportProto(paths []string) (*Result, error) {
+	result := &Result{}
+
+	var pending []protoPendingField
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		p := &protoParser{
+			file:   path,
+			tokens: tokenizeProto(string(data)),
+			result: result,
+		}
+		if err := p.parseFile(); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", path)
+		}
+		pending = append(pending, p.fields...)
+	}
+
+	resolveProtoFieldTypes(result, pending)
+	result.AttachEnums()
+
+	return result, nil
+}
+
+func tokenizeProto(src string) []protoToken {
+	var tokens []protoToken
+	var comment []string
+	line := 1
+	commentEndLine := 0
+	lastTokenLine := 0
+
+	addComment := func(text string) {
+		// Comments trailing a declaration on the same line are not descriptions
+		if lastTokenLine == line {
+			return
+		}
+		// A blank line detaches a comment from the next declaration
+		if len(comment) > 0 && line-commentEndLine > 1 {
+			comment = nil
+		}
+		if text != "" {
+			comment = append(comment, text)
+		}
+		commentEndLine = line
+	}
+
+	addToken := func(value string, withComment bool) {
+		t := protoToken{value: value, line: line}
+		if withComment && len(comment) > 0 && line-commentEndLine <= 1 {
+			t.comment = strings.Join(comment, " ")
+		}
+		tokens = append(tokens, t)
+		comment = nil
+		lastTokenLine = line
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			addComment(strings.TrimSpace(strings.TrimPrefix(src[i:i+end], "//")))
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			for _, l := range strings.Split(src[i+2:i+2+end], "\n") {
+				addComment(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(l), "*")))
+				line++
+			}
+			line--
+			i += end + 4
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			addToken(src[i:min(j+1, len(src))], false)
+			i = j + 1
+		case isProtoIdentChar(rune(c)):
+			j := i
+			for j < len(src) && (isProtoIdentChar(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			addToken(src[i:j], true)
+			i = j
+		default:
+			addToken(string(c), false)
+			i++
+		}
+	}
+
+	return tokens
+}
+
+func isProtoIdentChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (p *protoParser) peek() protoToken {
+	if p.pos >= len(p.tokens) {
+		return protoToken{}
+	}
+
+	return p.tokens[p.pos]
+}
+
+func (p *protoParser) next() protoToken {
+	t := p.peek()
+	p.pos++
+
+	return t
+}
+
+func (p *protoParser) expect(value string) error {
+	t := p.next()
+	if t.value != value {
+		return errors.Errorf("line %d: expected %q but got %q", t.line, value, t.value)
+	}
+
+	return nil
+}
+
+// skipStatement skips to the end of the current statement, including any
+// nested block.
+func (p *protoParser) skipStatement() {
+	depth := 0
+	for p.pos < len(p.tokens) {
+		t := p.next()
+		switch t.value {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth <= 0 {
+				return
+			}
+		case ";":
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+func (p *protoParser) parseFile() error {
+	for p.pos < len(p.tokens) {
+		t := p.peek()
+		switch t.value {
+		case "syntax":
+			p.next()
+			p.next()
+			version := p.next()
+			if strings.Trim(version.value, `"'`) != "proto3" {
+				p.result.Reportf("%s: syntax %s is not proto3, required and default values are ignored", p.file, version.value)
+			}
+			p.skipStatement()
+		case "message":
+			if err := p.parseMessage(); err != nil {
+				return err
+			}
+		case "enum":
+			if err := p.parseEnum(); err != nil {
+				return err
+			}
+		case "service", "extend":
+			p.next()
+			name := p.next()
+			p.result.Reportf("%s: %s %s has no codema equivalent and was skipped", p.file, t.value, name.value)
+			p.skipStatement()
+		case ";":
+			p.next()
+		default:
+			// package, import and option statements
+			p.skipStatement()
+		}
+	}
+
+	return nil
+}
+
+func (p *protoParser) scopedName(name string) string {
+	return strings.Join(p.scope, "") + name
+}
+
+func (p *protoParser) parseMessage() error {
+	keyword := p.next()
+	name := p.next()
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+
+	model := NewModel(p.scopedName(name.value), keyword.comment)
+	modelIdx := len(p.result.Models)
+	p.result.Models = append(p.result.Models, model)
+
+	p.scope = append(p.scope, name.value)
+	defer func() {
+		p.scope = p.scope[:len(p.scope)-1]
+	}()
+
+	return p.parseMessageBody(modelIdx, "")
+}
+
+// parseMessageBody parses fields until the closing brace. oneof is the name of
+// the enclosing oneof, if any.
+func (p *protoParser) parseMessageBody(modelIdx int, oneof string) error {
+	modelName := p.result.Models[modelIdx].Name
+
+	for {
+		t := p.peek()
+		switch t.value {
+		case "":
+			return errors.Errorf("unexpected end of file in message %s", modelName)
+		case "}":
+			p.next()
+			return nil
+		case ";":
+			p.next()
+		case "message":
+			if err := p.parseMessage(); err != nil {
+				return err
+			}
+		case "enum":
+			if err := p.parseEnum(); err != nil {
+				return err
+			}
+		case "option", "reserved", "extensions":
+			p.skipStatement()
+		case "extend":
+			p.result.Reportf("%s: extend in message %s has no codema equivalent and was skipped", p.file, modelName)
+			p.skipStatement()
+		case "oneof":
+			p.next()
+			name := p.next()
+			if err := p.expect("{"); err != nil {
+				return err
+			}
+			p.result.Reportf("%s: oneof %s.%s was flattened into optional fields", p.file, modelName, name.value)
+			if err := p.parseMessageBody(modelIdx, name.value); err != nil {
+				return err
+			}
+		case "map":
+			for p.pos < len(p.tokens) && p.next().value != ">" {
+			}
+			name := p.next()
+			p.skipStatement()
+			p.result.Reportf("%s: map field %s.%s has no codema equivalent and was skipped", p.file, modelName, name.value)
+		default:
+			if err := p.parseField(modelIdx, oneof != ""); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (p *protoParser) parseField(modelIdx int, inOneof bool) error {
+	first := p.next()
+	comment := first.comment
+
+	var repeated, optional bool
+	typeTok := first
+	switch first.value {
+	case "repeated":
+		repeated = true
+		typeTok = p.next()
+	case "optional":
+		optional = true
+		typeTok = p.next()
+	case "required":
+		typeTok = p.next()
+	}
+
+	name := p.next()
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	p.skipStatement()
+
+	model := &p.result.Models[modelIdx]
+	model.Fields = append(model.Fields, NewField(name.value, "", comment, optional || inOneof))
+	p.fields = append(p.fields, protoPendingField{
+		model:     modelIdx,
+		field:     len(model.Fields) - 1,
+		typeName:  typeTok.value,
+		scope:     append([]string(nil), p.scope...),
+		repeated:  repeated,
+		fieldName: model.Name + "." + name.value,
+	})
+
+	return nil
+}
+
+func (p *protoParser) parseEnum() error {
+	keyword := p.next()
+	name := p.next()
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+
+	enum := config.EnumDefinition{
+		Name:        p.scopedName(name.value),
+		Description: keyword.comment,
+	}
+	for {
+		t := p.next()
+		switch t.value {
+		case "":
+			return errors.Errorf("unexpected end of file in enum %s", enum.Name)
+		case "}":
+			p.result.Enums = append(p.result.Enums, enum)
+			return nil
+		case ";":
+		case "option", "reserved":
+			p.skipStatement()
+		default:
+			enum.Values = append(enum.Values, t.value)
+			p.skipStatement()
+		}
+	}
+}
+
+// resolveProtoFieldTypes maps the raw proto types of all fields once every
+// message and enum is known, so fields may reference types declared later.
+func resolveProtoFieldTypes(result *Result, pending []protoPendingField) {
+	var dropped []protoPendingField
+	for _, pf := range pending {
+		fieldType, ok := resolveProtoType(result, pf.typeName, pf.scope)
+		if !ok {
+			result.Reportf("field %s has unsupported type %s and was skipped", pf.fieldName, pf.typeName)
+			dropped = append(dropped, pf)
+			continue
+		}
+		if pf.typeName == "uint64" || pf.typeName == "fixed64" {
+			result.Reportf("field %s of type %s was mapped to Int, values above the int64 range will overflow", pf.fieldName, pf.typeName)
+		}
+		if pf.repeated {
+			fieldType = "[" + fieldType + "]"
+		}
+		result.Models[pf.model].Fields[pf.field].Type = fieldType
+	}
+
+	// Remove dropped fields back to front so the indexes stay valid
+	for i := len(dropped) - 1; i >= 0; i-- {
+		pf := dropped[i]
+		fields := result.Models[pf.model].Fields
+		result.Models[pf.model].Fields = append(fields[:pf.field], fields[pf.field+1:]...)
+	}
+}
+
+func resolveProtoType(result *Result, typeName string, scope []string) (string, bool) {
+	if t, ok := protoScalarTypes[typeName]; ok {
+		return t, true
+	}
+	if t, ok := protoWellKnownTypes[strings.TrimPrefix(typeName, ".")]; ok {
+		return t, true
+	}
+	if strings.HasPrefix(typeName, "google.protobuf.") || typeName == "bytes" {
+		return "", false
+	}
+
+	// Resolve the name from the innermost scope outwards, like protoc does.
+	// Package qualifiers are dropped since codema types are not namespaced.
+	parts := strings.Split(strings.TrimPrefix(typeName, "."), ".")
+	for len(parts) > 1 && len(parts[0]) > 0 && unicode.IsLower(rune(parts[0][0])) {
+		parts = parts[1:]
+	}
+	name := strings.Join(parts, "")
+	for i := len(scope); i >= 0; i-- {
+		candidate := strings.Join(scope[:i], "") + name
+		if result.HasModel(candidate) {
+			return candidate, true
+		}
+		if _, ok := result.GetEnumByName(candidate); ok {
+			return candidate, true
+		}
+	}
+
+	return "", false
+}
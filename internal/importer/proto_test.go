@@ -0,0 +1,7 @@
+package importer
+
+import "testing"
+
+func TestImportProto(t *testing.T) {
+	checkImport(t, ImportProto, "proto.proto")
+}
@@ -0,0 +1,755 @@
+package importer
+
+import (
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/iancoleman/strcase"
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/pkg/errors"
+)
+
+type (
+	sqlToken struct {
+		value string
+		// quoted is set for quoted identifiers and string literals, which are
+		// never keywords
+		quoted bool
+		line   int
+	}
+
+	sqlImporter struct {
+		file   string
+		result *Result
+		tables []*sqlTable
+		// enums maps the lower case SQL type name of every enum to its codema name
+		enums map[string]string
+	}
+
+	sqlTable struct {
+		file        string
+		name        string
+		description string
+		columns     []*sqlColumn
+		// relations are the lower case names of the relationship fields
+		// added for foreign keys
+		relations map[string]bool
+	}
+
+	sqlColumn struct {
+		name      string
+		typeName  string
+		array     bool
+		notNull   bool
+		primary   bool
+		refTable  string
+		refColumn string
+		cascade   bool
+		// composite is set on the columns of foreign keys spanning several
+		// columns, which no single relationship field stands for
+		composite   bool
+		description string
+		line        int
+	}
+)
+
+var sqlColumnTypes = map[string]string{
+	"text":                        "String",
+	"varchar":                     "String",
+	"character varying":           "String",
+	"char":                        "String",
+	"character":                   "String",
+	"citext":                      "String",
+	"uuid":                        "String",
+	"smallint":                    "Int",
+	"integer":                     "Int",
+	"int":                         "Int",
+	"int2":                        "Int",
+	"int4":                        "Int",
+	"int8":                        "Int",
+	"bigint":                      "Int",
+	"serial":                      "Int",
+	"smallserial":                 "Int",
+	"bigserial":                   "Int",
+	"real":                        "Float",
+	"float":                       "Float",
+	"float4":                      "Float",
+	"float8":                      "Float",
+	"double precision":            "Float",
+	"numeric":                     "Float",
+	"decimal":                     "Float",
+	"boolean":                     "Boolean",
+	"bool":                        "Boolean",
+	"timestamp":                   "DateTime",
+	"timestamptz":                 "DateTime",
+	"timestamp with time zone":    "DateTime",
+	"timestamp without time zone": "DateTime",
+	"date":                        "DateTime",
+}
+
+// sqlColumnStops are the keywords that end the type of a column definition
+var sqlColumnStops = map[string]bool{
+	"not": true, "null": true, "primary": true, "references": true, "default": true,
+	"unique": true, "check": true, "constraint": true, "collate": true, "generated": true,
+}
+
+// ImportSQL reads CREATE TABLE and CREATE TYPE ... AS ENUM statements of
+// Postgres DDL files into codema models and enums. Nullable columns become
+// optional fields, primary keys are tagged ID and foreign keys become fields
+// typed as the referenced model, next to the column kept with a references
+// directive.
+func ImportSQL(paths []string) (*Result, error) {
+	imp := &sqlImporter{
+		result: &Result{},
+		enums:  make(map[string]string),
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		imp.file = path
+		for _, stmt := range splitSQLStatements(tokenizeSQL(string(data))) {
+			if err := imp.importStatement(stmt); err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s", path)
+			}
+		}
+	}
+
+	// Tables are turned into models once all files are read, so foreign keys
+	// and enum columns may reference types declared later
+	for _, t := range imp.tables {
+		imp.result.Models = append(imp.result.Models, imp.tableModel(t))
+	}
+	imp.result.AttachEnums()
+
+	return imp.result, nil
+}
+
+func tokenizeSQL(src string) []sqlToken {
+	var tokens []sqlToken
+	line := 1
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "--"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case c == '\'' || c == '"':
+			// Quotes are escaped by doubling them
+			var sb strings.Builder
+			start := line
+			j := i + 1
+			for j < len(src) {
+				if src[j] == c {
+					if j+1 < len(src) && src[j+1] == c {
+						sb.WriteByte(c)
+						j += 2
+						continue
+					}
+					break
+				}
+				if src[j] == '\n' {
+					line++
+				}
+				sb.WriteByte(src[j])
+				j++
+			}
+			tokens = append(tokens, sqlToken{value: sb.String(), quoted: true, line: start})
+			i = j + 1
+		case isSQLIdentChar(rune(c)):
+			j := i
+			for j < len(src) && (isSQLIdentChar(rune(src[j])) || src[j] == '$') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{value: src[i:j], line: line})
+			i = j
+		case strings.HasPrefix(src[i:], "::"):
+			tokens = append(tokens, sqlToken{value: "::", line: line})
+			i += 2
+		default:
+			tokens = append(tokens, sqlToken{value: string(c), line: line})
+			i++
+		}
+	}
+
+	return tokens
+}
+
+func isSQLIdentChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func splitSQLStatements(tokens []sqlToken) [][]sqlToken {
+	var stmts [][]sqlToken
+	var current []sqlToken
+	for _, t := range tokens {
+		if t.value == ";" && !t.quoted {
+			if len(current) > 0 {
+				stmts = append(stmts, current)
+			}
+			current = nil
+			continue
+		}
+		current = append(current, t)
+	}
+	if len(current) > 0 {
+		stmts = append(stmts, current)
+	}
+
+	return stmts
+}
+
+// sqlStatement walks the tokens of a single statement.
+type sqlStatement struct {
+	tokens []sqlToken
+	pos    int
+}
+
+func (s *sqlStatement) peek() sqlToken {
+	if s.pos >= len(s.tokens) {
+		return sqlToken{}
+	}
+
+	return s.tokens[s.pos]
+}
+
+func (s *sqlStatement) next() sqlToken {
+	t := s.peek()
+	s.pos++
+
+	return t
+}
+
+// is reports whether the next token is the given keyword.
+func (s *sqlStatement) is(keyword string) bool {
+	t := s.peek()
+	return !t.quoted && strings.EqualFold(t.value, keyword)
+}
+
+// accept consumes the given keywords if they are next.
+func (s *sqlStatement) accept(keywords ...string) bool {
+	start := s.pos
+	for _, k := range keywords {
+		if !s.is(k) {
+			s.pos = start
+			return false
+		}
+		s.pos++
+	}
+
+	return true
+}
+
+func (s *sqlStatement) expect(value string) error {
+	t := s.next()
+	if t.value != value || t.quoted {
+		return errors.Errorf("line %d: expected %q but got %q", t.line, value, t.value)
+	}
+
+	return nil
+}
+
+// name reads a possibly schema qualified name and returns its last part.
+func (s *sqlStatement) name() string {
+	name := s.next().value
+	for s.peek().value == "." && !s.peek().quoted {
+		s.next()
+		name = s.next().value
+	}
+
+	return name
+}
+
+// nameList reads a parenthesized list of names.
+func (s *sqlStatement) nameList() ([]string, error) {
+	if err := s.expect("("); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for {
+		names = append(names, s.next().value)
+		t := s.next()
+		if t.value == ")" {
+			return names, nil
+		}
+		if t.value != "," {
+			return nil, errors.Errorf("line %d: expected \",\" or \")\" but got %q", t.line, t.value)
+		}
+	}
+}
+
+// skipParens skips a parenthesized group if one is next.
+func (s *sqlStatement) skipParens() {
+	if s.peek().value != "(" {
+		return
+	}
+
+	depth := 0
+	for s.pos < len(s.tokens) {
+		t := s.next()
+		if t.quoted {
+			continue
+		}
+		switch t.value {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+func (imp *sqlImporter) importStatement(tokens []sqlToken) error {
+	s := &sqlStatement{tokens: tokens}
+
+	switch {
+	case s.accept("create"):
+		s.accept("or", "replace")
+		for s.accept("global") || s.accept("local") || s.accept("temporary") || s.accept("temp") || s.accept("unlogged") {
+		}
+		switch {
+		case s.accept("table"):
+			return imp.importTable(s)
+		case s.accept("type"):
+			return imp.importType(s)
+		case s.is("domain"), s.is("view"):
+			kind := strings.ToLower(s.next().value)
+			imp.result.Reportf("%s: %s %s has no codema equivalent and was skipped", imp.file, kind, s.name())
+		}
+	case s.accept("comment", "on"):
+		return imp.importComment(s)
+	case s.accept("alter", "table"):
+		return imp.importAlterTable(s)
+	}
+
+	// Indexes, grants, inserts and other statements have no codema equivalent
+	return nil
+}
+
+func (imp *sqlImporter) importTable(s *sqlStatement) error {
+	s.accept("if", "not", "exists")
+	table := &sqlTable{file: imp.file, name: s.name()}
+	if s.is("of") || s.is("partition") {
+		imp.result.Reportf("%s: typed or partition table %s was skipped", imp.file, table.name)
+		return nil
+	}
+	if err := s.expect("("); err != nil {
+		return err
+	}
+	imp.tables = append(imp.tables, table)
+
+	for {
+		if s.peek().value == ")" && !s.peek().quoted {
+			s.next()
+			break
+		}
+		if s.pos >= len(s.tokens) {
+			return errors.Errorf("unexpected end of statement in table %s", table.name)
+		}
+
+		if s.is("constraint") || s.is("primary") || s.is("foreign") || s.is("unique") || s.is("check") || s.is("exclude") || s.is("like") {
+			if err := imp.importTableConstraint(s, table); err != nil {
+				return err
+			}
+		} else if err := imp.importColumn(s, table); err != nil {
+			return err
+		}
+
+		if s.peek().value == "," {
+			s.next()
+		}
+	}
+
+	if s.accept("inherits") {
+		imp.result.Reportf("%s: inheritance of table %s is not supported, only its own columns were imported", imp.file, table.name)
+	}
+
+	return nil
+}
+
+func (imp *sqlImporter) importColumn(s *sqlStatement, table *sqlTable) error {
+	nameTok := s.next()
+	col := &sqlColumn{name: nameTok.value, line: nameTok.line}
+
+	// The type runs until the first constraint keyword, possibly spanning
+	// several words as in double precision, with modifiers dropped
+	var typeWords []string
+	for {
+		t := s.peek()
+		if t.value == "" || (!t.quoted && (t.value == "," || t.value == ")" || sqlColumnStops[strings.ToLower(t.value)])) {
+			break
+		}
+		switch {
+		case t.value == "(":
+			s.skipParens()
+			continue
+		case t.value == "[":
+			col.array = true
+		case t.value == "]", t.value == ".":
+		case strings.EqualFold(t.value, "array"):
+			col.array = true
+		default:
+			// Keep the last part of schema qualified types only
+			if len(typeWords) > 0 && s.tokens[s.pos-1].value == "." {
+				typeWords = typeWords[:len(typeWords)-1]
+			}
+			typeWords = append(typeWords, strings.ToLower(t.value))
+		}
+		s.next()
+	}
+	col.typeName = strings.Join(typeWords, " ")
+
+	for {
+		t := s.peek()
+		if t.value == "" || (!t.quoted && (t.value == "," || t.value == ")")) {
+			break
+		}
+		switch {
+		case s.accept("not", "null"):
+			col.notNull = true
+		case s.accept("primary", "key"):
+			col.primary = true
+		case s.accept("references"):
+			col.refTable = s.name()
+			if s.peek().value == "(" {
+				cols, err := s.nameList()
+				if err != nil {
+					return err
+				}
+				col.refColumn = cols[0]
+			}
+		case s.accept("on", "delete", "cascade"):
+			col.cascade = true
+		case t.value == "(":
+			s.skipParens()
+		default:
+			s.next()
+		}
+	}
+
+	table.columns = append(table.columns, col)
+
+	return nil
+}
+
+func (imp *sqlImporter) importTableConstraint(s *sqlStatement, table *sqlTable) error {
+	if s.accept("constraint") {
+		s.next()
+	}
+
+	switch {
+	case s.accept("primary", "key"):
+		cols, err := s.nameList()
+		if err != nil {
+			return err
+		}
+		for _, c := range cols {
+			if col := table.column(c); col != nil {
+				col.primary = true
+			}
+		}
+	case s.accept("foreign", "key"):
+		cols, err := s.nameList()
+		if err != nil {
+			return err
+		}
+		if !s.accept("references") {
+			return errors.Errorf("line %d: expected REFERENCES after FOREIGN KEY", s.peek().line)
+		}
+		refTable := s.name()
+		var refCols []string
+		if s.peek().value == "(" {
+			refCols, err = s.nameList()
+			if err != nil {
+				return err
+			}
+		}
+		cascade := false
+		for s.pos < len(s.tokens) && s.peek().value != "," && s.peek().value != ")" {
+			if s.accept("on", "delete", "cascade") {
+				cascade = true
+				continue
+			}
+			s.next()
+		}
+		if len(cols) > 1 {
+			imp.result.Reportf("%s: composite foreign key of table %s was imported as one reference per column, without a relationship field", imp.file, table.name)
+		}
+		for cx, c := range cols {
+			col := table.column(c)
+			if col == nil {
+				continue
+			}
+			col.refTable = refTable
+			if cx < len(refCols) {
+				col.refColumn = refCols[cx]
+			}
+			col.cascade = col.cascade || cascade
+			col.composite = len(cols) > 1
+		}
+	}
+
+	// Skip the rest of the constraint, such as UNIQUE and CHECK bodies
+	for s.pos < len(s.tokens) {
+		t := s.peek()
+		if !t.quoted && (t.value == "," || t.value == ")") {
+			break
+		}
+		if t.value == "(" {
+			s.skipParens()
+			continue
+		}
+		s.next()
+	}
+
+	return nil
+}
+
+func (imp *sqlImporter) importAlterTable(s *sqlStatement) error {
+	s.accept("if", "exists")
+	s.accept("only")
+	table := imp.table(s.name())
+	if table == nil || !s.accept("add") {
+		return nil
+	}
+	if s.is("constraint") || s.is("primary") || s.is("foreign") {
+		return imp.importTableConstraint(s, table)
+	}
+
+	s.accept("column")
+	s.accept("if", "not", "exists")
+	return imp.importColumn(s, table)
+}
+
+func (imp *sqlImporter) importType(s *sqlStatement) error {
+	name := s.name()
+	if !s.accept("as", "enum") {
+		imp.result.Reportf("%s: type %s is not an enum and was skipped", imp.file, name)
+		return nil
+	}
+	if err := s.expect("("); err != nil {
+		return err
+	}
+
+	enum := config.EnumDefinition{Name: strcase.ToCamel(name)}
+	for {
+		t := s.next()
+		switch {
+		case t.value == "":
+			return errors.Errorf("unexpected end of statement in enum %s", name)
+		case t.value == ")" && !t.quoted:
+			imp.enums[strings.ToLower(name)] = enum.Name
+			imp.result.Enums = append(imp.result.Enums, enum)
+			return nil
+		case t.quoted:
+			enum.Values = append(enum.Values, t.value)
+		}
+	}
+}
+
+// importComment reads COMMENT ON TABLE and COMMENT ON COLUMN statements into
+// descriptions.
+func (imp *sqlImporter) importComment(s *sqlStatement) error {
+	var parts []string
+	kind := strings.ToLower(s.next().value)
+	parts = append(parts, s.next().value)
+	for s.peek().value == "." {
+		s.next()
+		parts = append(parts, s.next().value)
+	}
+	if !s.accept("is") {
+		return nil
+	}
+	text := s.next().value
+
+	switch kind {
+	case "table":
+		if t := imp.table(parts[len(parts)-1]); t != nil {
+			t.description = text
+		}
+	case "column":
+		if len(parts) < 2 {
+			return nil
+		}
+		if t := imp.table(parts[len(parts)-2]); t != nil {
+			if c := t.column(parts[len(parts)-1]); c != nil {
+				c.description = text
+			}
+		}
+	case "type":
+		for ex, en := range imp.result.Enums {
+			if en.Name == imp.enums[strings.ToLower(parts[len(parts)-1])] {
+				imp.result.Enums[ex].Description = text
+			}
+		}
+	}
+
+	return nil
+}
+
+func (imp *sqlImporter) table(name string) *sqlTable {
+	for _, t := range imp.tables {
+		if strings.EqualFold(t.name, name) {
+			return t
+		}
+	}
+
+	return nil
+}
+
+func (t *sqlTable) column(name string) *sqlColumn {
+	for _, c := range t.columns {
+		if strings.EqualFold(c.name, name) {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func (t *sqlTable) primaryKey() *sqlColumn {
+	for _, c := range t.columns {
+		if c.primary {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func (imp *sqlImporter) tableModel(t *sqlTable) config.ModelDefinition {
+	model := NewModel(sqlModelName(t.name), t.description)
+
+	for _, col := range t.columns {
+		fieldName := model.Name + "." + col.name
+		fieldType, ok := imp.columnType(col)
+		if !ok {
+			imp.result.Reportf("%s: field %s has unsupported type %s and was skipped", t.file, fieldName, col.typeName)
+			continue
+		}
+
+		field := NewField(col.name, fieldType, col.description, !col.notNull && !col.primary)
+		if col.primary {
+			field.Tags = append(field.Tags, config.TagDefinition{Name: "ID", Type: config.TagTypeUnspecified})
+		}
+		var relation *config.FieldDefinition
+		if col.refTable != "" {
+			relation = imp.attachReference(t, &field, fieldName, col)
+		}
+
+		model.Fields = append(model.Fields, field)
+		if relation != nil {
+			model.Fields = append(model.Fields, *relation)
+		}
+	}
+
+	return model
+}
+
+// attachReference records a foreign key as a references directive naming the
+// referenced model and field, and returns the relationship field holding the
+// referenced model. Cascading deletes mean the row belongs to the referenced
+// one, so the field is also tagged as its parent.
+func (imp *sqlImporter) attachReference(t *sqlTable, field *config.FieldDefinition, fieldName string, col *sqlColumn) *config.FieldDefinition {
+	ref := imp.table(col.refTable)
+	if ref == nil {
+		imp.result.Reportf("%s: field %s references unknown table %s, the reference was dropped", t.file, fieldName, col.refTable)
+		return nil
+	}
+
+	refColumn := col.refColumn
+	if refColumn == "" {
+		if pk := ref.primaryKey(); pk != nil {
+			refColumn = pk.name
+		}
+	}
+
+	refModel := sqlModelName(ref.name)
+	field.Directives = setDirective(field.Directives, "references", refModel+"."+refColumn)
+	if col.cascade {
+		field.Tags = append(field.Tags, config.TagDefinition{Name: refModel, Type: config.TagTypeParent})
+	}
+	if refCol := ref.column(refColumn); refCol != nil && refCol.primary && field.Type == "String" && refCol.typeName == "uuid" {
+		field.Type = "ID"
+	}
+
+	if col.composite {
+		return nil
+	}
+
+	// customer_id holds a customer, other columns are named after the model
+	name := strcase.ToSnake(refModel)
+	if lower := strings.ToLower(col.name); strings.HasSuffix(lower, "_id") {
+		name = col.name[:len(col.name)-len("_id")]
+	}
+	if t.column(name) != nil || t.relations[strings.ToLower(name)] {
+		imp.result.Reportf("%s: field %s references %s, but no relationship field was added since %s is taken", t.file, fieldName, refModel, name)
+		return nil
+	}
+	if t.relations == nil {
+		t.relations = make(map[string]bool)
+	}
+	t.relations[strings.ToLower(name)] = true
+
+	relation := NewField(name, refModel, "", field.Optional)
+	return &relation
+}
+
+func (imp *sqlImporter) columnType(col *sqlColumn) (string, bool) {
+	fieldType, ok := sqlColumnTypes[col.typeName]
+	if !ok {
+		fieldType, ok = imp.enums[col.typeName]
+	}
+	if !ok {
+		return "", false
+	}
+
+	if col.primary && col.typeName == "uuid" {
+		fieldType = "ID"
+	}
+	if col.array {
+		fieldType = "[" + fieldType + "]"
+	}
+
+	return fieldType, true
+}
+
+// sqlModelName turns a table name such as order_items into a model name such
+// as OrderItem. Plurals are only trimmed for the common English endings.
+func sqlModelName(table string) string {
+	name := strings.ToLower(table)
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		name = strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"), strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		name = strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss") && !strings.HasSuffix(name, "us") && !strings.HasSuffix(name, "is"):
+		name = strings.TrimSuffix(name, "s")
+	}
+
+	return strcase.ToCamel(name)
+}
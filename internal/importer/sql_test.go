@@ -0,0 +1,7 @@
+package importer
+
+import "testing"
+
+func TestImportSQL(t *testing.T) {
+	checkImport(t, ImportSQL, "sql.sql")
+}
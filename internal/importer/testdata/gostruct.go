@@ -0,0 +1,43 @@
+package shop
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Status string
+
+const (
+	StatusOpen   Status = "open"
+	StatusClosed Status = "closed"
+)
+
+// Order is an order placed by a customer
+type Order struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	CreatedAt time.Time          `json:"created_at"`
+	// Note is left by the customer
+	Note   *string `json:"note,omitempty"`
+	Total  int64
+	Status Status
+	Items  []Item
+	Tags   []string
+	Raw    []byte
+	Meta   map[string]string
+	secret string
+	Audit
+}
+
+type Item struct {
+	SKU   string
+	Price float64
+}
+
+type Audit struct {
+	UpdatedBy string
+}
+
+type Page[T any] struct {
+	Items []T
+}
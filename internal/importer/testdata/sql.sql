@@ -0,0 +1,38 @@
+CREATE TYPE order_status AS ENUM ('open', 'closed');
+
+-- Customers of the shop
+CREATE TABLE customers (
+    id UUID PRIMARY KEY,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE orders (
+    id BIGSERIAL PRIMARY KEY,
+    customer_id UUID NOT NULL REFERENCES customers (id),
+    referrer_id UUID REFERENCES customers,
+    status order_status NOT NULL,
+    total NUMERIC(10, 2),
+    data JSONB,
+    tags TEXT[]
+);
+
+CREATE TABLE order_items (
+    order_id BIGINT NOT NULL,
+    position INT NOT NULL,
+    sku TEXT NOT NULL,
+    warehouse_id INT REFERENCES warehouses (id),
+    PRIMARY KEY (order_id, position),
+    CONSTRAINT order_items_order_fk FOREIGN KEY (order_id) REFERENCES orders (id)
+);
+
+COMMENT ON COLUMN orders.total IS 'Total in euros';
+
+CREATE TABLE reviews (
+    id SERIAL PRIMARY KEY,
+    author UUID REFERENCES customers ON DELETE CASCADE,
+    customer UUID REFERENCES customers,
+    order_id BIGINT,
+    item_position INT,
+    FOREIGN KEY (order_id, item_position) REFERENCES order_items (order_id, position)
+);
@@ -0,0 +1,172 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const manifestVersion = 1
+
+type (
+	// Manifest records every file codema generated, so files it no longer
+	// produces can be found and removed. Paths are stored relative to the
+	// directory of the manifest, so it can be committed.
+	Manifest struct {
+		path    string
+		baseDir string
+		Version int     `json:"version"`
+		Files   []Entry `json:"files"`
+	}
+
+	Entry struct {
+		Path         string `json:"path"`
+		Target       string `json:"target"`
+		Api          string `json:"api"`
+		Microservice string `json:"microservice,omitempty"`
+		Hash         string `json:"hash"`
+	}
+
+	RemoveStatus int
+)
+
+const (
+	Removed RemoveStatus = iota
+	// Missing means the file was already gone
+	Missing
+	// Edited means the file was changed since codema wrote it and was kept
+	Edited
+)
+
+// Load reads the manifest at path. A missing manifest is empty.
+func Load(path string) (*Manifest, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	m := &Manifest{
+		path:    path,
+		baseDir: filepath.Dir(path),
+		Version: manifestVersion,
+	}
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = json.Unmarshal(raw, m)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse manifest %s", path)
+	}
+	if m.Version != manifestVersion {
+		return nil, errors.Errorf("unsupported manifest version %d in %s", m.Version, path)
+	}
+
+	return m, nil
+}
+
+// Save writes the manifest sorted by path, so it diffs well when committed.
+func (m *Manifest) Save() error {
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(os.WriteFile(m.path, append(raw, '\n'), 0644))
+}
+
+// NewEntry describes a generated file at the absolute path abs.
+func (m *Manifest) NewEntry(abs, target, api, microservice string, content []byte) Entry {
+	return Entry{
+		Path:         m.RelPath(abs),
+		Target:       target,
+		Api:          api,
+		Microservice: microservice,
+		Hash:         HashContent(content),
+	}
+}
+
+// RelPath returns abs relative to the manifest, or abs itself when it is
+// outside the directory of the manifest.
+func (m *Manifest) RelPath(abs string) string {
+	rel, err := filepath.Rel(m.baseDir, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return abs
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// AbsPath returns the absolute path of an entry.
+func (m *Manifest) AbsPath(e Entry) string {
+	path := filepath.FromSlash(e.Path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(m.baseDir, path)
+}
+
+// Unmodified reports whether the file at the absolute path abs is tracked,
+// and whether content is still what was generated into it.
+func (m *Manifest) Unmodified(abs string, content []byte) (bool, bool) {
+	path := m.RelPath(abs)
+	for _, e := range m.Files {
+		if e.Path == path {
+			return true, HashContent(content) == e.Hash
+		}
+	}
+
+	return false, false
+}
+
+// Remove deletes the file of an entry unless it was edited since it was
+// generated, along with the directories that are left empty.
+func (m *Manifest) Remove(e Entry) (RemoveStatus, error) {
+	path := m.AbsPath(e)
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Missing, nil
+	}
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if HashContent(content) != e.Hash {
+		return Edited, nil
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	// Remove parent directories up to the manifest directory while empty
+	for dir := filepath.Dir(path); strings.HasPrefix(dir, m.baseDir+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return Removed, nil
+}
+
+func HashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/innovation-upstream/codema/internal/config"
 	"github.com/pkg/errors"
@@ -12,7 +13,9 @@ type ModelRegistry interface {
 	RegisterModel(model config.ModelDefinition) error
 }
 
+// modelRegistry is safe for concurrent use.
 type modelRegistry struct {
+	mu     sync.RWMutex
 	models map[string]config.ModelDefinition
 }
 
@@ -28,6 +31,9 @@ func NewModelRegistery(initialModels map[string]config.ModelDefinition) ModelReg
 }
 
 func (r *modelRegistry) GetModelByName(name string) config.ModelDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	m, ok := r.models[name]
 	if ok {
 		return m
@@ -37,6 +43,9 @@ func (r *modelRegistry) GetModelByName(name string) config.ModelDefinition {
 }
 
 func (r *modelRegistry) RegisterModel(model config.ModelDefinition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if _, ok := r.models[model.Name]; ok {
 		return errors.New(fmt.Sprintf("Model with name %s already registered", model.Name))
 	}
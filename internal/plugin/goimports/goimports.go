@@ -1,10 +1,13 @@
 package goimports
 
 import (
+	"bytes"
 	"context"
-	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"golang.org/x/tools/imports"
@@ -12,37 +15,46 @@ import (
 
 type GoImportsPlugin struct{}
 
+// Command is the hidden codema command running goimports in another process,
+// for files of another module than the working directory's. goimports finds
+// the module of a file through the working directory, which is shared by the
+// whole process, so changing it would serialize every goimports run.
+const Command = "goimports-file"
+
+var (
+	workingModuleOnce sync.Once
+	workingModule     string
+)
+
 func (p *GoImportsPlugin) Name() string {
 	return "GoImports"
 }
 
 func (p *GoImportsPlugin) PreWriteFile(ctx context.Context, filename string, content []byte) ([]byte, error) {
-	// Get the directory of the file
-	dir := filepath.Dir(filename)
-
-	// Get the current working directory
-	originalDir, err := os.Getwd()
+	filename, err := filepath.Abs(filename)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get current working directory")
+		return nil, errors.WithStack(err)
 	}
 
-	// Change to the directory of the file
-	err = os.Chdir(dir)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to change to file directory")
+	// Get the directory of the file. Files are processed before they are
+	// written, so fall back to the closest directory that already exists,
+	// which belongs to the same module.
+	dir := existingDir(filepath.Dir(filename))
+
+	if moduleRoot(dir) == workingDirModule() {
+		return Process(filename, content)
 	}
 
-	// Ensure we change back to the original directory when we're done
-	defer func() {
-		err := os.Chdir(originalDir)
-		if err != nil {
-			// Log the error, but don't return it as the main operation has already completed
-			// You might want to use a proper logger here
-			slog.Warn("Warning: failed to change back to original directory", slog.String("error", err.Error()))
-		}
-	}()
+	return processInDir(ctx, dir, filename, content)
+}
+
+func (p *GoImportsPlugin) PreExecTemplate(ctx context.Context, templateContent []byte) ([]byte, error) {
+	return templateContent, nil
+}
 
-	// Run goimports
+// Process runs goimports on the content of filename, resolving imports
+// against the module of the working directory.
+func Process(filename string, content []byte) ([]byte, error) {
 	opts := &imports.Options{
 		TabWidth:  4,
 		TabIndent: true,
@@ -50,7 +62,7 @@ func (p *GoImportsPlugin) PreWriteFile(ctx context.Context, filename string, con
 		Fragment:  true,
 	}
 
-	processedContent, err := imports.Process(filepath.Base(filename), content, opts)
+	processedContent, err := imports.Process(filename, content, opts)
 	if err != nil {
 		return nil, errors.Wrap(err, "goimports processing failed")
 	}
@@ -58,6 +70,70 @@ func (p *GoImportsPlugin) PreWriteFile(ctx context.Context, filename string, con
 	return processedContent, nil
 }
 
-func (p *GoImportsPlugin) PreExecTemplate(ctx context.Context, templateContent []byte) ([]byte, error) {
-	return templateContent, nil
+// processInDir runs goimports with dir as the working directory, in a codema
+// subprocess.
+func processInDir(ctx context.Context, dir, filename string, content []byte) ([]byte, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find the codema executable")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, executable, Command, filename)
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, errors.Wrap(err, "goimports processing failed")
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func workingDirModule() string {
+	workingModuleOnce.Do(func() {
+		dir, err := os.Getwd()
+		if err == nil {
+			workingModule = moduleRoot(dir)
+		}
+	})
+
+	return workingModule
+}
+
+// moduleRoot returns the closest directory holding a go.mod, or "" outside
+// of modules.
+func moduleRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func existingDir(dir string) string {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil && info.IsDir() {
+			return dir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
 }
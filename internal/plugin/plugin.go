@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"context"
+	"sync"
 )
 
 type Plugin interface {
@@ -10,7 +11,10 @@ type Plugin interface {
 	PreExecTemplate(ctx context.Context, templateContent []byte) ([]byte, error)
 }
 
+// PluginRegistry is safe for concurrent use. Plugins themselves may be called
+// for several files at once and must guard any state they share.
 type PluginRegistry struct {
+	mu      sync.RWMutex
 	plugins map[string][]Plugin
 }
 
@@ -21,6 +25,9 @@ func NewPluginRegistry() *PluginRegistry {
 }
 
 func (r *PluginRegistry) Register(targetLabel string, plugin Plugin) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if _, ok := r.plugins[targetLabel]; !ok {
 		r.plugins[targetLabel] = []Plugin{}
 	}
@@ -28,9 +35,21 @@ func (r *PluginRegistry) Register(targetLabel string, plugin Plugin) {
 }
 
 func (r *PluginRegistry) GetPlugins(targetLabel string) []Plugin {
-	return r.plugins[targetLabel]
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]Plugin(nil), r.plugins[targetLabel]...)
 }
 
+// GetRegister returns a copy of the registered plugins by target label.
 func (r *PluginRegistry) GetRegister() map[string][]Plugin {
-	return r.plugins
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	register := make(map[string][]Plugin, len(r.plugins))
+	for label, plugins := range r.plugins {
+		register[label] = append([]Plugin(nil), plugins...)
+	}
+
+	return register
 }
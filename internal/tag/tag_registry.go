@@ -3,6 +3,7 @@ package tag
 import (
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/innovation-upstream/codema/internal/config"
 )
@@ -12,7 +13,9 @@ type TagRegistry interface {
 	RegisterTag(tag config.TagDefinition) error
 }
 
+// tagRegistry is safe for concurrent use.
 type tagRegistry struct {
+	mu   sync.RWMutex
 	tags map[string]config.TagDefinition
 }
 
@@ -28,10 +31,16 @@ func NewTagRegistery(initialTags map[string]config.TagDefinition) TagRegistry {
 }
 
 func (r *tagRegistry) GetTagByName(name string) config.TagDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	return r.tags[name]
 }
 
 func (r *tagRegistry) RegisterTag(tag config.TagDefinition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if _, ok := r.tags[tag.Name]; ok {
 		return errors.New(fmt.Sprintf("Tag with name %s already registered", tag.Name))
 	}
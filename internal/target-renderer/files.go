@@ -0,0 +1,209 @@
+package targetrenderer
+
+import (
+	"html/template"
+	"strings"
+	"unicode"
+
+	"github.com/gobuffalo/plush"
+	"github.com/pkg/errors"
+)
+
+// Templates emit files besides their own output with file blocks, written
+// {{ file "path" }}...{{ end }} in Go templates and
+// <%= file("path") { %>...<% } %> in Plush templates. Renderers mark the
+// blocks in their output, and SplitFiles takes them out again.
+const (
+	fileBeginMarker = "\x00codema-file:"
+	fileEndMarker   = "\x00codema-end\x00"
+)
+
+// EmittedFile is a file emitted by a file block. Path is as written in the
+// template.
+type EmittedFile struct {
+	Path    string
+	Content string
+}
+
+// rewriteFileBlocks turns the file blocks of a Go template into calls of the
+// marker functions, as the end of a file block cannot be told apart from the
+// end of other blocks without following their nesting.
+func rewriteFileBlocks(templateContent string) (string, error) {
+	var out strings.Builder
+	var blocks []string
+	rest := templateContent
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			out.WriteString(rest)
+			break
+		}
+		end := start + actionLen(rest[start:])
+		out.WriteString(rest[:start])
+		out.WriteString(rewriteAction(rest[start:end], &blocks))
+		rest = rest[end:]
+	}
+
+	for _, b := range blocks {
+		if b == "file" {
+			return "", errors.New("file block is not closed with {{ end }}")
+		}
+	}
+
+	return out.String(), nil
+}
+
+// actionLen returns the length of the action at the start of s, skipping
+// over strings, character constants and comments, which may hold braces. An
+// action without an end runs to the end of s, for the parser to report.
+func actionLen(s string) int {
+	for i := 2; i < len(s); i++ {
+		switch {
+		case s[i] == '"' || s[i] == '\'' || s[i] == '`':
+			i = quotedEnd(s, i)
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return len(s)
+			}
+			i += 2 + end + 1
+		case strings.HasPrefix(s[i:], "}}"):
+			return i + 2
+		}
+	}
+
+	return len(s)
+}
+
+// quotedEnd returns the index of the quote closing the string or character
+// constant opened at s[start].
+func quotedEnd(s string, start int) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote != '`':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+
+	return len(s)
+}
+
+// rewriteAction tracks the blocks an action opens and closes, replacing the
+// keyword of the actions opening and closing file blocks with the marker
+// functions.
+func rewriteAction(action string, blocks *[]string) string {
+	start := 2
+	if strings.HasPrefix(action[start:], "-") {
+		start++
+	}
+	for start < len(action) && isTemplateSpace(action[start]) {
+		start++
+	}
+	end := start
+	for end < len(action) && isTemplateIdentChar(action[end]) {
+		end++
+	}
+
+	replace := func(name string) string {
+		return action[:start] + name + action[end:]
+	}
+
+	switch keyword := action[start:end]; keyword {
+	case "if", "range", "with", "block", "define":
+		*blocks = append(*blocks, keyword)
+	case "file":
+		*blocks = append(*blocks, keyword)
+		return replace("codemaFileBegin")
+	case "end":
+		if len(*blocks) == 0 {
+			return action
+		}
+		opened := (*blocks)[len(*blocks)-1]
+		*blocks = (*blocks)[:len(*blocks)-1]
+		if opened == "file" {
+			return replace("codemaFileEnd")
+		}
+	}
+
+	return action
+}
+
+func isTemplateSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isTemplateIdentChar(c byte) bool {
+	return c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+func fileBegin(path string) (string, error) {
+	if path == "" || strings.ContainsAny(path, "\x00\n") {
+		return "", errors.Errorf("invalid file block path %q", path)
+	}
+
+	return fileBeginMarker + path + "\x00", nil
+}
+
+func fileEnd() string {
+	return fileEndMarker
+}
+
+func plushFileHelper(path string, help plush.HelperContext) (template.HTML, error) {
+	begin, err := fileBegin(path)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := help.Block()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return template.HTML(begin + content + fileEndMarker), nil
+}
+
+// SplitFiles takes the files emitted by file blocks out of a rendered
+// template. The content of every block and, when there were blocks, what is
+// left around them are trimmed like the output of Go templates.
+func SplitFiles(rendered string) (string, []EmittedFile, error) {
+	if !strings.Contains(rendered, fileBeginMarker) {
+		if strings.Contains(rendered, fileEndMarker) {
+			return "", nil, errors.New("file block end without a beginning")
+		}
+		return rendered, nil, nil
+	}
+
+	var main strings.Builder
+	var files []EmittedFile
+	rest := rendered
+	for {
+		before, after, found := strings.Cut(rest, fileBeginMarker)
+		if strings.Contains(before, fileEndMarker) {
+			return "", nil, errors.New("file block end without a beginning")
+		}
+		main.WriteString(before)
+		if !found {
+			break
+		}
+
+		path, after, _ := strings.Cut(after, "\x00")
+		content, after, found := strings.Cut(after, fileEndMarker)
+		if !found {
+			return "", nil, errors.Errorf("file block %s is not closed", path)
+		}
+		if strings.Contains(content, fileBeginMarker) {
+			return "", nil, errors.Errorf("file block %s contains another file block", path)
+		}
+
+		files = append(files, EmittedFile{
+			Path:    path,
+			Content: strings.TrimSpace(content),
+		})
+		rest = after
+	}
+
+	return strings.TrimSpace(main.String()), files, nil
+}
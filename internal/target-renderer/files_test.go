@@ -0,0 +1,166 @@
+package targetrenderer
+
+import (
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+func TestRewriteFileBlocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "file block",
+			tmpl: `{{ file "a.txt" }}a{{ end }}`,
+			want: `{{ codemaFileBegin "a.txt" }}a{{ codemaFileEnd }}`,
+		},
+		{
+			name: "trim markers",
+			tmpl: `{{- file .Path -}}a{{- end -}}`,
+			want: `{{- codemaFileBegin .Path -}}a{{- codemaFileEnd -}}`,
+		},
+		{
+			name: "nested blocks",
+			tmpl: `{{ range .Items }}{{ file .Path }}{{ if .X }}x{{ else }}y{{ end }}{{ end }}{{ end }}`,
+			want: `{{ range .Items }}{{ codemaFileBegin .Path }}{{ if .X }}x{{ else }}y{{ end }}{{ codemaFileEnd }}{{ end }}`,
+		},
+		{
+			name: "identifier starting with file",
+			tmpl: `{{ with fileName }}{{ . }}{{ end }}{{ filepath "a" }}`,
+			want: `{{ with fileName }}{{ . }}{{ end }}{{ filepath "a" }}`,
+		},
+		{
+			name: "braces in strings",
+			tmpl: `{{ file "{{a}}.txt" }}{{ if eq .X "}}" }}{{ printf ` + "`{{ end }}`" + ` }}{{ end }}{{ end }}`,
+			want: `{{ codemaFileBegin "{{a}}.txt" }}{{ if eq .X "}}" }}{{ printf ` + "`{{ end }}`" + ` }}{{ end }}{{ codemaFileEnd }}`,
+		},
+		{
+			name: "escaped quotes",
+			tmpl: `{{ file "a\"}}.txt" }}{{ '}' }}{{ end }}`,
+			want: `{{ codemaFileBegin "a\"}}.txt" }}{{ '}' }}{{ codemaFileEnd }}`,
+		},
+		{
+			name: "comments",
+			tmpl: `{{/* {{ file "a" }} */}}{{- /* }} */ -}}{{ file "b" }}{{ end }}`,
+			want: `{{/* {{ file "a" }} */}}{{- /* }} */ -}}{{ codemaFileBegin "b" }}{{ codemaFileEnd }}`,
+		},
+		{
+			name: "end without block",
+			tmpl: `{{ end }}`,
+			want: `{{ end }}`,
+		},
+		{
+			name:    "unclosed file block",
+			tmpl:    `{{ file "a" }}{{ if .X }}{{ end }}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rewriteFileBlocks(tt.tmpl)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("rewriteFileBlocks() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("rewriteFileBlocks() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoTemplateFileBlocks(t *testing.T) {
+	tmpl := `main
+{{ range .Files }}{{ file (printf "%s.txt" .) }}
+{{ if eq . "b" }}"}}" {{ . }}{{ else }}{{ . }}{{ end }}
+{{ end }}{{ end }}`
+
+	rendered, err := (&GoTemplateTargetRenderer{}).Render(tmpl, map[string]interface{}{"Files": []string{"a", "b"}}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, files, err := SplitFiles(rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "main" {
+		t.Errorf("content = %q, want %q", content, "main")
+	}
+	want := []EmittedFile{
+		{Path: "a.txt", Content: "a"},
+		{Path: "b.txt", Content: `"}}" b`},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %+v, want %+v", files, want)
+	}
+}
+
+func TestSplitFiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		rendered    string
+		wantContent string
+		wantFiles   []EmittedFile
+		wantErr     bool
+	}{
+		{
+			name:        "no blocks",
+			rendered:    " main \n",
+			wantContent: " main \n",
+		},
+		{
+			name:        "blocks",
+			rendered:    "main\n" + fileBeginMarker + "a\x00\n a \n" + fileEndMarker + "\n",
+			wantContent: "main",
+			wantFiles:   []EmittedFile{{Path: "a", Content: "a"}},
+		},
+		{
+			name:     "unclosed block",
+			rendered: fileBeginMarker + "a\x00a",
+			wantErr:  true,
+		},
+		{
+			name:     "end without beginning",
+			rendered: "a" + fileEndMarker,
+			wantErr:  true,
+		},
+		{
+			name:     "nested blocks",
+			rendered: fileBeginMarker + "a\x00" + fileBeginMarker + "b\x00b" + fileEndMarker + fileEndMarker,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, files, err := SplitFiles(tt.rendered)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("SplitFiles() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content != tt.wantContent {
+				t.Errorf("content = %q, want %q", content, tt.wantContent)
+			}
+			if !reflect.DeepEqual(files, tt.wantFiles) {
+				t.Errorf("files = %+v, want %+v", files, tt.wantFiles)
+			}
+		})
+	}
+}
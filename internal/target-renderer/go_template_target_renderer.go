@@ -1,6 +1,7 @@
 package targetrenderer
 
 import (
+	"log/slog"
 	"strings"
 	"text/template"
 
@@ -12,10 +13,43 @@ import (
 	"github.com/pkg/errors"
 )
 
-type GoTemplateTargetRenderer struct{}
+type GoTemplateTargetRenderer struct {
+	// Partials are parsed into the template set before the template, so the
+	// template can use them and override their blocks
+	Partials Partials
+	// Funcs are template functions defined in Starlark, which may override
+	// the built-in ones
+	Funcs config.TemplateFuncs
+}
+
+func (r *GoTemplateTargetRenderer) Render(templateContent string, data interface{}, logger *slog.Logger) (string, error) {
+	tmpl := template.New("").Funcs(templateFuncs()).Funcs(starlarkFuncs(r.Funcs, logger)).Funcs(goTmpl.FuncMap{
+		"codemaFileBegin": fileBegin,
+		"codemaFileEnd":   fileEnd,
+	})
+
+	for _, path := range r.Partials.Names() {
+		name, ok := goTemplateName(path)
+		if !ok {
+			continue
+		}
+
+		partial, err := rewriteFileBlocks(r.Partials[path])
+		if err != nil {
+			return "", errors.Wrapf(err, "partial %s", path)
+		}
+		_, err = tmpl.New(name).Parse(partial)
+		if err != nil {
+			return "", errors.Wrapf(err, "partial %s", path)
+		}
+	}
+
+	templateContent, err := rewriteFileBlocks(templateContent)
+	if err != nil {
+		return "", err
+	}
 
-func (r *GoTemplateTargetRenderer) Render(templateContent string, data interface{}) (string, error) {
-	tmpl, err := template.New("").Funcs(templateFuncs()).Parse(templateContent)
+	tmpl, err = tmpl.Parse(templateContent)
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
@@ -51,8 +85,8 @@ func templateFuncs() goTmpl.FuncMap {
 		"lowerCamelCase":                strcase.ToLowerCamel,
 		"mapGraphQLType":                mapGraphQLType,
 		"mapGraphQLInputType":           mapGraphQLInputType,
-		"getGraphqlTypeForField":        getGraphqlTypeForField,
-		"getGraphqlNameForField":        getGraphqlNameForField,
+		"getGraphqlTypeForField":        GetGraphqlTypeForField,
+		"getGraphqlNameForField":        GetGraphqlNameForField,
 		"mapTypescriptType":             mapTypescriptType,
 		"fieldHasTag":                   fieldHasTag,
 		"isPrimitiveFieldType":          config.IsPrimitiveFieldType,
@@ -163,7 +197,7 @@ func mapGraphQLInputType(t string) string {
 	}
 }
 
-func getGraphqlTypeForField(f config.FieldDefinition) string {
+func GetGraphqlTypeForField(f config.FieldDefinition) string {
 	mask := f.GetDirectiveStringValue(directive.WellKnownDirectiveGraphQLTypeNameMask)
 	if mask != "" {
 		return mask
@@ -172,7 +206,7 @@ func getGraphqlTypeForField(f config.FieldDefinition) string {
 	return mapGraphQLType(f.Type)
 }
 
-func getGraphqlNameForField(f config.FieldDefinition) string {
+func GetGraphqlNameForField(f config.FieldDefinition) string {
 	mask := f.GetDirectiveStringValue(directive.WellKnownDirectiveGraphQLFieldNameMask)
 	if mask != "" {
 		return mask
@@ -0,0 +1,75 @@
+package targetrenderer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Partials are the templates of the partials directory by their path
+// relative to it, shared by the templates of every target.
+type Partials map[string]string
+
+// LoadPartials reads every file under dir.
+func LoadPartials(dir string) (Partials, error) {
+	partials := make(Partials)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		partials[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read partials %s", dir)
+	}
+
+	return partials, nil
+}
+
+// Names returns the paths of the partials in order.
+func (p Partials) Names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// goTemplateName is the name Go templates use a partial by, its path without
+// the template extension. Plush and Starlark partials are left out.
+func goTemplateName(path string) (string, bool) {
+	if strings.HasSuffix(path, ".plush") || strings.HasSuffix(path, ".star") {
+		return "", false
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(path, ".template"), ".gotemplate"), true
+}
+
+// plushFeeder looks up the partials used by Plush templates, which may leave
+// out the .plush extension.
+func (p Partials) plushFeeder(name string) (string, error) {
+	if content, ok := p[name]; ok {
+		return content, nil
+	}
+	if content, ok := p[name+".plush"]; ok {
+		return content, nil
+	}
+
+	return "", errors.Errorf("partial %s not found", name)
+}
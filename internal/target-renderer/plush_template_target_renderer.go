@@ -1,28 +1,83 @@
 package targetrenderer
 
 import (
+	"log/slog"
+	"reflect"
+	"strings"
+
 	"github.com/gobuffalo/plush"
+	"github.com/innovation-upstream/codema/internal/config"
 	"github.com/pkg/errors"
 )
 
-type PlushTemplateTargetRenderer struct{}
+// PlushTemplateTargetRenderer renders Plush templates. They get the same data
+// as Go templates, with its fields as top level variables like Api and
+// Microservice, and data holding all of it. The gobuffalo helpers come with
+// every Plush context, besides the template functions of Go templates.
+type PlushTemplateTargetRenderer struct {
+	// Partials are rendered with the partial helper
+	Partials Partials
+	// Funcs are template functions defined in Starlark, which may override
+	// the built-in ones
+	Funcs config.TemplateFuncs
+}
 
-func (r *PlushTemplateTargetRenderer) Render(templateContent string, data interface{}) (string, error) {
+func (r *PlushTemplateTargetRenderer) Render(templateContent string, data interface{}, logger *slog.Logger) (string, error) {
 	ctx := plush.NewContext()
 	ctx.Set("data", data)
+	for name, value := range topLevelValues(data) {
+		ctx.Set(name, value)
+	}
 
 	for name, fn := range templateFuncs() {
 		ctx.Set(name, fn)
 	}
+	for name, fn := range starlarkFuncs(r.Funcs, logger) {
+		ctx.Set(name, fn)
+	}
+	ctx.Set("file", plushFileHelper)
+	ctx.Set("partialFeeder", r.Partials.plushFeeder)
 
 	result, err := plush.Render(templateContent, ctx)
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
 
-	return result, nil
+	// Trimmed like the output of Go templates
+	return strings.TrimSpace(result), nil
 }
 
 func (r *PlushTemplateTargetRenderer) GetType() TargetRendererType {
 	return TargetRendererType_Plush
 }
+
+// topLevelValues returns the exported fields of a struct, or the entries of
+// a map with string keys, by name.
+func topLevelValues(data interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return values
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				values[v.Type().Field(i).Name] = v.Field(i).Interface()
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			for _, key := range v.MapKeys() {
+				values[key.String()] = v.MapIndex(key).Interface()
+			}
+		}
+	}
+
+	return values
+}
@@ -1,13 +1,18 @@
 package targetrenderer
 
+import "log/slog"
+
 type TargetRendererType uint32
 
 const (
 	TargetRendererType_GoTemplate = 1
 	TargetRendererType_Plush      = 2
+	TargetRendererType_Starlark   = 3
 )
 
 type TargetRenderer interface {
-	Render(templateContent string, data interface{}) (string, error)
+	// Render renders a template with data. Templates printing messages, like
+	// Starlark print, log them to logger
+	Render(templateContent string, data interface{}, logger *slog.Logger) (string, error)
 	GetType() TargetRendererType
 }
@@ -0,0 +1,128 @@
+package targetrenderer
+
+import (
+	"log/slog"
+	"reflect"
+	"strings"
+
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/pkg/errors"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// StarlarkTargetRenderer renders Starlark templates, which define a
+// render(ctx) function returning the content of the file, or a dict of files
+// by path like file blocks, with the file of the target under "". ctx holds
+// the data of Go templates, frozen, and the template functions of Go
+// templates are builtins.
+type StarlarkTargetRenderer struct {
+	// Name names the template in errors
+	Name string
+	// Partials may be loaded by Starlark templates, like
+	// load("helpers.star", "field_list")
+	Partials Partials
+	// Funcs are template functions defined in Starlark, which may override
+	// the built-in ones
+	Funcs config.TemplateFuncs
+}
+
+func (r *StarlarkTargetRenderer) Render(templateContent string, data interface{}, logger *slog.Logger) (string, error) {
+	builtins := starlarkBuiltins()
+	for name, fn := range r.Funcs.Funcs {
+		builtins[name] = fn
+	}
+	loaded := make(map[string]starlark.StringDict)
+	thread := &starlark.Thread{
+		Name: r.Name,
+		Print: func(_ *starlark.Thread, msg string) {
+			logger.Debug(msg, slog.String("template", r.Name))
+		},
+		Load: func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+			if globals, ok := loaded[module]; ok {
+				return globals, nil
+			}
+			content, ok := r.Partials[module]
+			if !ok {
+				return nil, errors.Errorf("partial %s not found", module)
+			}
+			globals, err := starlark.ExecFileOptions(syntax.LegacyFileOptions(), thread, module, content, builtins)
+			loaded[module] = globals
+			return globals, err
+		},
+	}
+
+	globals, err := starlark.ExecFileOptions(syntax.LegacyFileOptions(), thread, r.Name, templateContent, builtins)
+	if err != nil {
+		return "", starlarkError(err)
+	}
+
+	render, ok := globals["render"].(starlark.Callable)
+	if !ok {
+		return "", errors.Errorf("%s does not define a render(ctx) function", r.Name)
+	}
+
+	ctx, err := toStarlark(data)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := starlark.Call(thread, render, starlark.Tuple{ctx}, nil)
+	if err != nil {
+		return "", starlarkError(err)
+	}
+
+	switch result := result.(type) {
+	case starlark.String:
+		// Trimmed like the output of Go templates
+		return strings.TrimSpace(string(result)), nil
+	case *starlark.Dict:
+		var main, files strings.Builder
+		for _, item := range result.Items() {
+			path, ok := starlark.AsString(item[0])
+			if !ok {
+				return "", errors.Errorf("render returned a file path of type %s, want string", item[0].Type())
+			}
+			content, ok := starlark.AsString(item[1])
+			if !ok {
+				return "", errors.Errorf("render returned content of type %s for %s, want string", item[1].Type(), path)
+			}
+			if path == "" {
+				main.WriteString(strings.TrimSpace(content))
+				continue
+			}
+
+			begin, err := fileBegin(path)
+			if err != nil {
+				return "", err
+			}
+			files.WriteString(begin + content + fileEndMarker)
+		}
+		return main.String() + files.String(), nil
+	}
+
+	return "", errors.Errorf("render returned %s, want a string or a dict of files", result.Type())
+}
+
+func (r *StarlarkTargetRenderer) GetType() TargetRendererType {
+	return TargetRendererType_Starlark
+}
+
+// starlarkBuiltins are the template functions of Go templates.
+func starlarkBuiltins() starlark.StringDict {
+	builtins := make(starlark.StringDict)
+	for name, fn := range templateFuncs() {
+		builtins[name] = goFunc(name, reflect.ValueOf(fn))
+	}
+
+	return builtins
+}
+
+// starlarkError reports where in the template an error happened.
+func starlarkError(err error) error {
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return errors.New(evalErr.Backtrace())
+	}
+
+	return errors.WithStack(err)
+}
@@ -0,0 +1,363 @@
+package targetrenderer
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/pkg/errors"
+	"go.starlark.net/starlark"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// goStruct exposes a Go struct to Starlark, read only. Its exported fields
+// and methods keep their Go names, so Starlark templates use data the way Go
+// templates do, with methods called like
+// ctx.Microservice.PrimaryModel.GetDirectiveStringValue("table").
+type goStruct struct {
+	v reflect.Value
+}
+
+var _ starlark.HasAttrs = (*goStruct)(nil)
+
+func (s *goStruct) String() string {
+	return fmt.Sprintf("%+v", s.v.Interface())
+}
+
+func (s *goStruct) Type() string {
+	return s.v.Type().String()
+}
+
+func (s *goStruct) Freeze() {}
+
+func (s *goStruct) Truth() starlark.Bool {
+	return starlark.True
+}
+
+func (s *goStruct) Hash() (uint32, error) {
+	return 0, errors.Errorf("unhashable type: %s", s.Type())
+}
+
+func (s *goStruct) Attr(name string) (starlark.Value, error) {
+	if m := s.v.MethodByName(name); m.IsValid() {
+		return goFunc(name, m), nil
+	}
+
+	st := reflect.Indirect(s.v)
+	field, ok := st.Type().FieldByName(name)
+	if !ok || !field.IsExported() {
+		return nil, nil
+	}
+	v, err := st.FieldByIndexErr(field.Index)
+	if err != nil {
+		return starlark.None, nil
+	}
+
+	return toStarlarkValue(v)
+}
+
+func (s *goStruct) AttrNames() []string {
+	var names []string
+	st := reflect.Indirect(s.v)
+	for i := 0; i < st.NumField(); i++ {
+		if st.Type().Field(i).IsExported() {
+			names = append(names, st.Type().Field(i).Name)
+		}
+	}
+	for i := 0; i < s.v.NumMethod(); i++ {
+		names = append(names, s.v.Type().Method(i).Name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// toStarlark converts a Go value to a frozen Starlark value.
+func toStarlark(v interface{}) (starlark.Value, error) {
+	return toStarlarkValue(reflect.ValueOf(v))
+}
+
+func toStarlarkValue(v reflect.Value) (starlark.Value, error) {
+	if !v.IsValid() {
+		return starlark.None, nil
+	}
+	if v.CanInterface() {
+		if sv, ok := v.Interface().(starlark.Value); ok {
+			return sv, nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return starlark.None, nil
+		}
+		// Pointers to structs are kept for their pointer methods
+		if v.Kind() == reflect.Pointer && v.Elem().Kind() == reflect.Struct {
+			return &goStruct{v: v}, nil
+		}
+		return toStarlarkValue(v.Elem())
+	case reflect.Bool:
+		return starlark.Bool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return starlark.MakeInt64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return starlark.MakeUint64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return starlark.Float(v.Float()), nil
+	case reflect.String:
+		return starlark.String(v.String()), nil
+	case reflect.Slice, reflect.Array:
+		elems := make([]starlark.Value, v.Len())
+		for i := range elems {
+			elem, err := toStarlarkValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = elem
+		}
+		list := starlark.NewList(elems)
+		list.Freeze()
+		return list, nil
+	case reflect.Map:
+		// Sorted like Go templates range over maps
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		dict := starlark.NewDict(len(keys))
+		for _, key := range keys {
+			k, err := toStarlarkValue(key)
+			if err != nil {
+				return nil, err
+			}
+			val, err := toStarlarkValue(v.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(k, val); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+		dict.Freeze()
+		return dict, nil
+	case reflect.Struct:
+		return &goStruct{v: v}, nil
+	}
+
+	return nil, errors.Errorf("cannot convert %s to a Starlark value", v.Type())
+}
+
+// fromStarlark converts a Starlark value to a Go value of type t.
+func fromStarlark(v starlark.Value, t reflect.Type) (reflect.Value, error) {
+	if s, ok := v.(*goStruct); ok {
+		switch {
+		case s.v.Type().AssignableTo(t):
+			return s.v, nil
+		case s.v.Kind() == reflect.Pointer && s.v.Elem().Type().AssignableTo(t):
+			return s.v.Elem(), nil
+		}
+	}
+
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		generic, err := fromStarlarkGeneric(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if generic == nil {
+			return reflect.Zero(t), nil
+		}
+		return reflect.ValueOf(generic), nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		if s, ok := starlark.AsString(v); ok {
+			return reflect.ValueOf(s).Convert(t), nil
+		}
+	case reflect.Bool:
+		if b, ok := v.(starlark.Bool); ok {
+			return reflect.ValueOf(bool(b)).Convert(t), nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := v.(starlark.Int); ok {
+			if n, ok := i.Int64(); ok {
+				return reflect.ValueOf(n).Convert(t), nil
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i, ok := v.(starlark.Int); ok {
+			if n, ok := i.Uint64(); ok {
+				return reflect.ValueOf(n).Convert(t), nil
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := starlark.AsFloat(v); ok {
+			return reflect.ValueOf(f).Convert(t), nil
+		}
+	case reflect.Slice:
+		if seq, ok := v.(starlark.Indexable); ok {
+			slice := reflect.MakeSlice(t, seq.Len(), seq.Len())
+			for i := 0; i < seq.Len(); i++ {
+				elem, err := fromStarlark(seq.Index(i), t.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				slice.Index(i).Set(elem)
+			}
+			return slice, nil
+		}
+	case reflect.Map:
+		if dict, ok := v.(*starlark.Dict); ok {
+			m := reflect.MakeMapWithSize(t, dict.Len())
+			for _, item := range dict.Items() {
+				key, err := fromStarlark(item[0], t.Key())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				val, err := fromStarlark(item[1], t.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				m.SetMapIndex(key, val)
+			}
+			return m, nil
+		}
+	}
+
+	return reflect.Value{}, errors.Errorf("cannot use %s as %s", v.Type(), t)
+}
+
+// fromStarlarkGeneric converts a Starlark value to the Go value it most
+// naturally maps to.
+func fromStarlarkGeneric(v starlark.Value) (interface{}, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		if n, ok := v.Int64(); ok {
+			if int64(int(n)) == n {
+				return int(n), nil
+			}
+			return n, nil
+		}
+		return nil, errors.Errorf("integer %s is too large", v)
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.String:
+		return string(v), nil
+	case *goStruct:
+		return v.v.Interface(), nil
+	case *starlark.Dict:
+		m := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, errors.Errorf("dict keys must be strings, got %s", item[0].Type())
+			}
+			val, err := fromStarlarkGeneric(item[1])
+			if err != nil {
+				return nil, err
+			}
+			m[key] = val
+		}
+		return m, nil
+	case starlark.Indexable:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			elem, err := fromStarlarkGeneric(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = elem
+		}
+		return list, nil
+	}
+
+	return nil, errors.Errorf("cannot convert %s to a Go value", v.Type())
+}
+
+// goFunc exposes a Go function to Starlark. Like in Go templates, a last
+// error result fails the call.
+func goFunc(name string, fn reflect.Value) *starlark.Builtin {
+	return starlark.NewBuiltin(name, func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if len(kwargs) > 0 {
+			return nil, errors.Errorf("%s: unexpected keyword arguments", name)
+		}
+
+		t := fn.Type()
+		if (!t.IsVariadic() && len(args) != t.NumIn()) || (t.IsVariadic() && len(args) < t.NumIn()-1) {
+			return nil, errors.Errorf("%s: got %d arguments, want %d", name, len(args), t.NumIn())
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			paramType := t.In(min(i, t.NumIn()-1))
+			if t.IsVariadic() && i >= t.NumIn()-1 {
+				paramType = t.In(t.NumIn() - 1).Elem()
+			}
+
+			var err error
+			in[i], err = fromStarlark(arg, paramType)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s: argument %d", name, i+1)
+			}
+		}
+
+		out := fn.Call(in)
+		if len(out) > 0 && t.Out(len(out)-1) == errorType {
+			if err := out[len(out)-1]; !err.IsNil() {
+				return nil, errors.Wrap(err.Interface().(error), name)
+			}
+			out = out[:len(out)-1]
+		}
+		if len(out) == 0 {
+			return starlark.None, nil
+		}
+
+		return toStarlarkValue(out[0])
+	})
+}
+
+// starlarkFuncs adapts template functions defined in Starlark to Go and Plush
+// templates, which report the template line of the call when they fail. The
+// functions print to logger.
+func starlarkFuncs(funcs config.TemplateFuncs, logger *slog.Logger) map[string]interface{} {
+	adapted := make(map[string]interface{}, len(funcs.Funcs))
+	for name, fn := range funcs.Funcs {
+		adapted[name] = starlarkFunc(name, fn, logger)
+	}
+
+	return adapted
+}
+
+func starlarkFunc(name string, fn starlark.Callable, logger *slog.Logger) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		starlarkArgs := make(starlark.Tuple, len(args))
+		for i, arg := range args {
+			v, err := toStarlark(arg)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s: argument %d", name, i+1)
+			}
+			starlarkArgs[i] = v
+		}
+
+		thread := &starlark.Thread{
+			Name: name,
+			Print: func(_ *starlark.Thread, msg string) {
+				logger.Debug(msg, slog.String("func", name))
+			},
+		}
+		result, err := starlark.Call(thread, fn, starlarkArgs, nil)
+		if err != nil {
+			return nil, starlarkError(err)
+		}
+
+		return fromStarlarkGeneric(result)
+	}
+}
@@ -0,0 +1,262 @@
+package target
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+const renderCacheVersion = 1
+
+type (
+	// RenderCache maps output paths to the hash of the inputs they were last
+	// rendered from, so units whose inputs did not change are neither
+	// rendered nor written again. It is safe for concurrent use.
+	RenderCache struct {
+		path    string
+		mu      sync.Mutex
+		entries map[string]RenderCacheEntry
+		hits    atomic.Int64
+		misses  atomic.Int64
+	}
+
+	RenderCacheEntry struct {
+		InputHash string `json:"inputHash"`
+		// OutputHash is empty when a unit emitted files but had none of its own
+		OutputHash string `json:"outputHash"`
+		// Files are the paths of the files a unit emitted besides its own
+		Files []string `json:"files,omitempty"`
+	}
+
+	renderCacheFile struct {
+		Version int                         `json:"version"`
+		Entries map[string]RenderCacheEntry `json:"entries"`
+	}
+)
+
+// LoadRenderCache reads the cache at path. A missing or outdated cache is
+// treated as empty.
+func LoadRenderCache(path string) (*RenderCache, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	c := &RenderCache{
+		path:    path,
+		entries: make(map[string]RenderCacheEntry),
+	}
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var f renderCacheFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse render cache %s", path)
+	}
+	if f.Version == renderCacheVersion && f.Entries != nil {
+		c.entries = f.Entries
+	}
+
+	return c, nil
+}
+
+// Lookup returns the files a unit with the output path rendered when it was
+// rendered from inputHash and they were not changed on disk since. A zero
+// mode matches any mode.
+func (c *RenderCache) Lookup(path, inputHash string, mode os.FileMode) ([]GeneratedFile, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[path]
+	var paths []string
+	entries := make(map[string]RenderCacheEntry)
+	if ok && entry.OutputHash != "" {
+		paths = append(paths, path)
+		entries[path] = entry
+	}
+	for _, p := range entry.Files {
+		paths = append(paths, p)
+		entries[p] = c.entries[p]
+	}
+	c.mu.Unlock()
+
+	if ok && entry.InputHash == inputHash {
+		var files []GeneratedFile
+		for _, p := range paths {
+			content, fresh := cachedContent(p, entries[p], inputHash, mode)
+			if !fresh {
+				files = nil
+				break
+			}
+			files = append(files, GeneratedFile{Path: p, Content: content})
+		}
+		if len(files) == len(paths) {
+			c.hits.Add(1)
+			return files, true
+		}
+	}
+
+	c.misses.Add(1)
+	return nil, false
+}
+
+// cachedContent returns the content of the file at path when it was rendered
+// from inputHash and is unchanged on disk.
+func cachedContent(path string, entry RenderCacheEntry, inputHash string, mode os.FileMode) ([]byte, bool) {
+	if entry.InputHash != inputHash {
+		return nil, false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || (mode != 0 && info.Mode().Perm() != mode.Perm()) {
+		return nil, false
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil || hashBytes(content) != entry.OutputHash {
+		return nil, false
+	}
+
+	return content, true
+}
+
+// Store records that the unit with the output path rendered files from
+// inputHash.
+func (c *RenderCache) Store(path, inputHash string, files []GeneratedFile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := RenderCacheEntry{InputHash: inputHash}
+	for _, f := range files {
+		if f.Path == path {
+			entry.OutputHash = hashBytes(f.Content)
+			continue
+		}
+
+		entry.Files = append(entry.Files, f.Path)
+		c.entries[f.Path] = RenderCacheEntry{
+			InputHash:  inputHash,
+			OutputHash: hashBytes(f.Content),
+		}
+	}
+	c.entries[path] = entry
+}
+
+func (c *RenderCache) Stats() (hits, misses int) {
+	return int(c.hits.Load()), int(c.misses.Load())
+}
+
+// Save writes the cache back to its path.
+func (c *RenderCache) Save() error {
+	c.mu.Lock()
+	raw, err := json.MarshalIndent(renderCacheFile{
+		Version: renderCacheVersion,
+		Entries: c.entries,
+	}, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(c.path), 0755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(os.WriteFile(c.path, raw, 0644))
+}
+
+// InputHash hashes everything a prepared unit renders from: the codema build
+// and the sources of the unit.
+func (u RenderUnit) InputHash(prepared PreparedUnit) (string, error) {
+	sourceHash, err := u.SourceHash(prepared)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	writeHashField(h, codemaBuildID())
+	writeHashField(h, sourceHash)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SourceHash hashes the sources of a prepared unit: the renderer, the mode
+// and options of the target, the template after injection, the partials, the
+// template functions defined in Starlark, the data and the plugins of the
+// target. Unlike InputHash it is the same for every codema build.
+func (u RenderUnit) SourceHash(prepared PreparedUnit) (string, error) {
+	data, err := json.Marshal(prepared.Data)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	h := sha256.New()
+	writeHashField(h, fmt.Sprint(u.renderer.GetType()))
+	writeHashField(h, u.FileMode().String())
+	writeHashField(h, fmt.Sprintf("%+v", u.Options))
+	writeHashField(h, prepared.Template)
+	// Any partial may be used by the template
+	for _, name := range u.Ctrl.Partials.Names() {
+		writeHashField(h, name)
+		writeHashField(h, u.Ctrl.Partials[name])
+	}
+	writeHashField(h, u.Ctrl.TemplateFuncs.SourceHash)
+	writeHashField(h, string(data))
+
+	// Plugins run in order, so their order is part of the key
+	for _, p := range u.Ctrl.PluginRegistry.GetPlugins(u.Ctrl.ParentTarget.Label) {
+		writeHashField(h, p.Name())
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeHashField writes a length prefixed field, so adjacent fields cannot
+// run into each other.
+func writeHashField(h hash.Hash, s string) {
+	fmt.Fprintf(h, "%d:%s", len(s), s)
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+var (
+	buildIDOnce sync.Once
+	buildID     string
+)
+
+// codemaBuildID identifies the running codema build, since template
+// functions and rendering may change between builds.
+func codemaBuildID() string {
+	buildIDOnce.Do(func() {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+
+		buildID = info.Main.Version
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" || s.Key == "vcs.modified" {
+				buildID += " " + s.Value
+			}
+		}
+	})
+
+	return buildID
+}
@@ -0,0 +1,142 @@
+package target
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/innovation-upstream/codema/internal/plugin"
+	"github.com/innovation-upstream/codema/internal/tag"
+	targetrenderer "github.com/innovation-upstream/codema/internal/target-renderer"
+)
+
+const conformanceDir = "testdata/conformance"
+
+// TestRendererConformance renders every case of the conformance fixture
+// through each template engine, and expects the same files from all of them.
+func TestRendererConformance(t *testing.T) {
+	cfg, err := config.NewYAMLConfigLoaderFromPath(filepath.Join(conformanceDir, "codema.yaml")).GetConfig()
+	if err != nil {
+		t.Fatalf("loading fixture config: %v", err)
+	}
+
+	templatesDir, err := filepath.Abs(filepath.Join(conformanceDir, "templates"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	partials, err := targetrenderer.LoadPartials(filepath.Join(templatesDir, "partials"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apis := make(map[string]config.ApiDefinition)
+	tagReg := tag.NewTagRegistery(nil)
+	for _, a := range cfg.Apis {
+		apis[a.Label] = a
+		for _, ms := range a.Microservices {
+			for _, field := range ms.PrimaryModel.Fields {
+				for _, fieldTag := range field.Tags {
+					tagReg.RegisterTag(fieldTag)
+				}
+			}
+		}
+	}
+
+	cases, err := os.ReadDir(filepath.Join(templatesDir, "cases"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range cases {
+		want := readTree(t, filepath.Join(templatesDir, "cases", c.Name(), "expected"))
+
+		for _, ext := range []string{".gotemplate", ".plush", ".star"} {
+			t.Run(c.Name()+ext, func(t *testing.T) {
+				outDir := t.TempDir()
+				ctrl := &TargetProcessorController{
+					ApiRegistry: apis,
+					ParentTarget: config.Target{
+						Label:        "conformance",
+						TemplatePath: "/cases/" + c.Name() + "/template" + ext,
+						Each:         config.EachMicroservice,
+						Options: config.TargetOptions{
+							TrailingNewline: config.TrailingNewlineEnsure,
+						},
+					},
+					TemplatesDir:   templatesDir,
+					PluginRegistry: plugin.NewPluginRegistry(),
+					TagRegistry:    tagReg,
+					Partials:       partials,
+				}
+
+				units, err := ctrl.PlanTargetApi(config.TargetApi{
+					Label:   "shop",
+					OutPath: filepath.Join(outDir, "main.txt"),
+				})
+				if err != nil {
+					t.Fatalf("planning: %v", err)
+				}
+				if len(units) != 1 {
+					t.Fatalf("planned %d units, want 1", len(units))
+				}
+
+				files, err := units[0].Render(slog.New(slog.NewTextHandler(io.Discard, nil)))
+				if err != nil {
+					t.Fatalf("rendering: %v", err)
+				}
+
+				got := make(map[string]string)
+				for _, f := range files {
+					rel, err := filepath.Rel(outDir, f.Path)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got[filepath.ToSlash(rel)] = string(f.Content)
+				}
+
+				for path, content := range want {
+					if got[path] != content {
+						t.Errorf("%s:\ngot:\n%q\nwant:\n%q", path, got[path], content)
+					}
+				}
+				for path := range got {
+					if _, ok := want[path]; !ok {
+						t.Errorf("unexpected file %s", path)
+					}
+				}
+			})
+		}
+	}
+}
+
+// readTree reads the files under dir by their slash separated path relative
+// to it.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
@@ -0,0 +1,139 @@
+package target
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/innovation-upstream/codema/internal/config"
+)
+
+type commentStyle struct {
+	prefix string
+	suffix string
+}
+
+var (
+	lineComment  = commentStyle{prefix: "// "}
+	hashComment  = commentStyle{prefix: "# "}
+	dashComment  = commentStyle{prefix: "-- "}
+	htmlComment  = commentStyle{prefix: "<!-- ", suffix: " -->"}
+	blockComment = commentStyle{prefix: "/* ", suffix: " */"}
+
+	// commentStyles maps file extensions to the comment style of headers
+	commentStyles = map[string]commentStyle{
+		".go":      lineComment,
+		".js":      lineComment,
+		".jsx":     lineComment,
+		".ts":      lineComment,
+		".tsx":     lineComment,
+		".java":    lineComment,
+		".kt":      lineComment,
+		".swift":   lineComment,
+		".dart":    lineComment,
+		".rs":      lineComment,
+		".c":       lineComment,
+		".h":       lineComment,
+		".cc":      lineComment,
+		".cpp":     lineComment,
+		".cs":      lineComment,
+		".proto":   lineComment,
+		".py":      hashComment,
+		".rb":      hashComment,
+		".sh":      hashComment,
+		".bash":    hashComment,
+		".yaml":    hashComment,
+		".yml":     hashComment,
+		".toml":    hashComment,
+		".star":    hashComment,
+		".bzl":     hashComment,
+		".graphql": hashComment,
+		".gql":     hashComment,
+		".tf":      hashComment,
+		".sql":     dashComment,
+		".lua":     dashComment,
+		".html":    htmlComment,
+		".xml":     htmlComment,
+		".md":      htmlComment,
+		".vue":     htmlComment,
+		".css":     blockComment,
+		".scss":    blockComment,
+	}
+
+	// commentStylesByName maps file names without a telling extension
+	commentStylesByName = map[string]commentStyle{
+		"BUILD":      hashComment,
+		"Dockerfile": hashComment,
+		"Makefile":   hashComment,
+	}
+)
+
+// provenanceHeader returns the header stating that the file at path is
+// generated and what it was generated from, in the comment style of the file.
+func (u RenderUnit) provenanceHeader(path, sourceHash string) (string, bool) {
+	style, ok := commentStyles[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		style, ok = commentStylesByName[filepath.Base(path)]
+	}
+	if !ok {
+		return "", false
+	}
+
+	t := u.Ctrl.ParentTarget
+	tmplPath := "/" + strings.TrimPrefix(strings.TrimPrefix(u.TemplatePath, u.Ctrl.TemplatesDir), "/")
+
+	// Files whose edits the write policy keeps must not be taken for
+	// generated code by linters and reviewers
+	generated := "Code generated by codema. DO NOT EDIT."
+	switch u.Options.WritePolicy {
+	case config.WritePolicyMerge:
+		generated = "Generated by codema. Edits are merged when it is generated again."
+	case config.WritePolicyCreateOnly:
+		generated = "Generated by codema. Edits are kept, it is not generated again."
+	}
+
+	lines := []string{
+		generated,
+		"Target: " + t.Label,
+		"Template: " + tmplPath,
+	}
+	if t.TemplateDir != "" {
+		lines = append(lines, "Version: "+getTemplateVersionPath(t.DefaultVersionPath, u.TargetApi.VersionPath))
+	}
+	if u.Ctrl.ConfigFile != "" {
+		lines = append(lines, "Config: "+u.Ctrl.ConfigFile)
+	}
+	lines = append(lines, "Inputs: sha256:"+sourceHash)
+
+	var header strings.Builder
+	for _, l := range lines {
+		fmt.Fprintf(&header, "%s%s%s\n", style.prefix, l, style.suffix)
+	}
+	// Keeps the header from becoming the doc comment of what follows
+	header.WriteString("\n")
+
+	return header.String(), true
+}
+
+// addProvenanceHeader puts the header at the top of content, after a shebang
+// line, which has to stay first.
+func (u RenderUnit) addProvenanceHeader(path, content string, prepared PreparedUnit, logger *slog.Logger) (string, error) {
+	sourceHash, err := u.SourceHash(prepared)
+	if err != nil {
+		return "", err
+	}
+
+	header, ok := u.provenanceHeader(path, sourceHash)
+	if !ok {
+		logger.Warn("No comment style for the file extension, skipping the provenance header", slog.String("path", path))
+		return content, nil
+	}
+
+	if strings.HasPrefix(content, "#!") {
+		shebang, rest, _ := strings.Cut(content, "\n")
+		return shebang + "\n" + header + rest, nil
+	}
+
+	return header + content, nil
+}
@@ -0,0 +1,47 @@
+package target
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/innovation-upstream/codema/internal/config"
+)
+
+func TestProvenanceHeaderWritePolicy(t *testing.T) {
+	tests := []struct {
+		policy    config.WritePolicy
+		wantFirst string
+	}{
+		{policy: "", wantFirst: "// Code generated by codema. DO NOT EDIT."},
+		{policy: config.WritePolicyOverwrite, wantFirst: "// Code generated by codema. DO NOT EDIT."},
+		{policy: config.WritePolicyOverwriteIfUnmodified, wantFirst: "// Code generated by codema. DO NOT EDIT."},
+		{policy: config.WritePolicyMerge, wantFirst: "// Generated by codema. Edits are merged when it is generated again."},
+		{policy: config.WritePolicyCreateOnly, wantFirst: "// Generated by codema. Edits are kept, it is not generated again."},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			u := RenderUnit{
+				Ctrl: &TargetProcessorController{
+					ParentTarget: config.Target{Label: "api"},
+				},
+				Options:      config.TargetOptions{WritePolicy: tt.policy},
+				TemplatePath: "/api.go.tmpl",
+			}
+
+			header, ok := u.provenanceHeader("api.go", "hash")
+			if !ok {
+				t.Fatal("provenanceHeader() found no comment style for .go")
+			}
+			first, _, _ := strings.Cut(header, "\n")
+			if first != tt.wantFirst {
+				t.Errorf("first header line = %q, want %q", first, tt.wantFirst)
+			}
+			if tt.policy == config.WritePolicyMerge || tt.policy == config.WritePolicyCreateOnly {
+				if strings.Contains(header, "DO NOT EDIT") {
+					t.Errorf("header of an editable file says DO NOT EDIT:\n%s", header)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package target
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/innovation-upstream/codema/internal/diff"
+	"github.com/pkg/errors"
+)
+
+// MergeBases stores the last generated version of every file written with
+// the merge write policy, which the next generated version is merged against.
+// Bases mirror the paths of their files relative to the project root.
+type MergeBases struct {
+	dir  string
+	root string
+}
+
+func NewMergeBases(dir string) (*MergeBases, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	root, err := os.Getwd()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &MergeBases{
+		dir:  dir,
+		root: root,
+	}, nil
+}
+
+// Path returns where the base of the file at the absolute path file is kept.
+func (b *MergeBases) Path(file string) string {
+	rel, err := filepath.Rel(b.root, file)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Join("_abs", file)
+	}
+
+	return filepath.Join(b.dir, rel)
+}
+
+// Remove deletes the base of the file at the absolute path file, along with
+// the directories it leaves empty, once the file itself is deleted. A file
+// generated at the same path later must not merge against it.
+func (b *MergeBases) Remove(file string) error {
+	path := b.Path(file)
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for dir := filepath.Dir(path); strings.HasPrefix(dir, b.dir+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// mergeExisting merges the changes between the previous and the new
+// generated output into the file on disk. The new generated output is
+// attached as the merge base to write along with the file.
+func (u RenderUnit) mergeExisting(f GeneratedFile, logger *slog.Logger) (GeneratedFile, error) {
+	if u.Ctrl.MergeBases == nil {
+		return f, errors.New("the merge write policy requires merge bases")
+	}
+
+	basePath := u.Ctrl.MergeBases.Path(f.Path)
+	f.MergeBase = &GeneratedFile{
+		Path:    basePath,
+		Content: f.Content,
+		Mode:    0644,
+	}
+
+	current, err := os.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return f, errors.WithStack(err)
+	}
+	if bytes.Equal(current, f.Content) {
+		return f, nil
+	}
+
+	base, err := os.ReadFile(basePath)
+	if os.IsNotExist(err) {
+		// Without the previous generated output, edits cannot be told apart
+		// from generated code. The file is kept, and only its merge base is
+		// written so it is merged from the next run
+		logger.Warn("No merge base for file, keeping it as is", slog.String("path", f.Path))
+		info, err := os.Stat(f.Path)
+		if err != nil {
+			return f, errors.WithStack(err)
+		}
+		return GeneratedFile{
+			Path:      f.Path,
+			Content:   current,
+			Mode:      info.Mode().Perm(),
+			MergeBase: f.MergeBase,
+			Kept:      true,
+		}, nil
+	}
+	if err != nil {
+		return f, errors.WithStack(err)
+	}
+
+	merged := diff.Merge3(base, current, f.Content, "current", "generated")
+	if merged.Conflicts > 0 {
+		logger.Warn("Merge conflicts, resolve the conflict markers", slog.String("path", f.Path), slog.Int("conflicts", merged.Conflicts))
+	}
+	f.Content = merged.Content
+	f.Conflicts = merged.Conflicts
+
+	return f, nil
+}
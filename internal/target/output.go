@@ -0,0 +1,46 @@
+package target
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// FileStatus is how a generated file compares to the file on disk.
+type FileStatus int
+
+const (
+	FileUnchanged FileStatus = iota
+	FileChanged
+	FileNew
+)
+
+func (s FileStatus) String() string {
+	switch s {
+	case FileChanged:
+		return "changed"
+	case FileNew:
+		return "new"
+	default:
+		return "unchanged"
+	}
+}
+
+// CompareGeneratedFile compares a generated file to the file on disk, which
+// is returned as well when it exists.
+func CompareGeneratedFile(f GeneratedFile) (FileStatus, []byte, error) {
+	current, err := os.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return FileNew, nil, nil
+	}
+	if err != nil {
+		return 0, nil, errors.WithStack(err)
+	}
+
+	if bytes.Equal(current, f.Content) {
+		return FileUnchanged, current, nil
+	}
+
+	return FileChanged, current, nil
+}
@@ -0,0 +1,115 @@
+package target
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/pkg/errors"
+)
+
+// WrittenFiles knows what codema last wrote to generated files.
+type WrittenFiles interface {
+	// Unmodified reports whether the file at path is tracked, and whether
+	// content is still what was generated into it
+	Unmodified(path string, content []byte) (bool, bool)
+}
+
+// applyWritePolicy decides what the file on disk becomes under the write
+// policy and permissions of the target.
+func (u RenderUnit) applyWritePolicy(f GeneratedFile, logger *slog.Logger) (GeneratedFile, error) {
+	options := u.Options
+	if options.WritePolicy == config.WritePolicyMerge {
+		var err error
+		f, err = u.mergeExisting(f, logger)
+		if err != nil || f.Kept {
+			return f, err
+		}
+	}
+
+	info, err := os.Stat(f.Path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return f, errors.WithStack(err)
+	}
+
+	if options.KeepPermissions {
+		f.Mode = info.Mode().Perm()
+	}
+
+	switch options.WritePolicy {
+	case config.WritePolicyCreateOnly:
+		return keepExisting(f, info.Mode().Perm())
+	case config.WritePolicyOverwriteIfUnmodified:
+		current, err := os.ReadFile(f.Path)
+		if err != nil {
+			return f, errors.WithStack(err)
+		}
+		if bytes.Equal(current, f.Content) {
+			return f, nil
+		}
+
+		var tracked, unmodified bool
+		if u.Ctrl.WrittenFiles != nil {
+			tracked, unmodified = u.Ctrl.WrittenFiles.Unmodified(f.Path, current)
+		}
+		if !tracked {
+			logger.Warn("Kept file that was not generated by codema", slog.String("path", f.Path))
+			return keepExisting(f, info.Mode().Perm())
+		}
+		if !unmodified {
+			logger.Warn("Kept file that was modified since it was generated", slog.String("path", f.Path))
+			return keepExisting(f, info.Mode().Perm())
+		}
+	}
+
+	return f, nil
+}
+
+// keepExisting turns f into the file on disk, so nothing is written.
+func keepExisting(f GeneratedFile, mode os.FileMode) (GeneratedFile, error) {
+	current, err := os.ReadFile(f.Path)
+	if err != nil {
+		return f, errors.WithStack(err)
+	}
+
+	return GeneratedFile{
+		Path:    f.Path,
+		Content: current,
+		Mode:    mode,
+		Kept:    true,
+	}, nil
+}
+
+// normalizeContent applies the line ending and trailing newline options of
+// a target.
+func normalizeContent(content []byte, options config.TargetOptions) []byte {
+	newline := []byte("\n")
+	switch options.LineEndings {
+	case config.LineEndingsLF:
+		content = bytes.ReplaceAll(content, []byte("\r\n"), newline)
+	case config.LineEndingsCRLF:
+		newline = []byte("\r\n")
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+		content = bytes.ReplaceAll(content, []byte("\n"), newline)
+	default:
+		if bytes.Contains(content, []byte("\r\n")) {
+			newline = []byte("\r\n")
+		}
+	}
+
+	switch options.TrailingNewline {
+	case config.TrailingNewlineEnsure:
+		content = bytes.TrimRight(content, "\r\n")
+		if len(content) > 0 {
+			content = append(content, newline...)
+		}
+	case config.TrailingNewlineTrim:
+		content = bytes.TrimRight(content, "\r\n")
+	}
+
+	return content
+}
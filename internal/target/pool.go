@@ -0,0 +1,182 @@
+package target
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// RenderResult is the outcome of rendering a unit. Files are the file at
+	// the path of the unit and the files its template emitted. Logs holds the
+	// records the unit logged, to be replayed in unit order. Cached is set
+	// when the files on disk were rendered from the same inputs and Files
+	// hold their current content.
+	RenderResult struct {
+		Unit      RenderUnit
+		Files     []GeneratedFile
+		Err       error
+		Logs      []slog.Record
+		Cached    bool
+		InputHash string
+	}
+
+	// RenderPool renders units on a bounded number of workers. Results are
+	// consumed in unit order with Next, regardless of the order in which the
+	// workers finish.
+	RenderPool struct {
+		units   []RenderUnit
+		cache   *RenderCache
+		results []RenderResult
+		done    []chan struct{}
+		next    int
+		stopped atomic.Bool
+		wg      sync.WaitGroup
+	}
+)
+
+var errRenderSkipped = errors.New("rendering skipped after an earlier failure")
+
+// NewRenderPool starts rendering units on jobs workers. cache may be nil to
+// render every unit.
+func NewRenderPool(units []RenderUnit, jobs int, cache *RenderCache) *RenderPool {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	p := &RenderPool{
+		units:   units,
+		cache:   cache,
+		results: make([]RenderResult, len(units)),
+		done:    make([]chan struct{}, len(units)),
+	}
+	for i := range p.done {
+		p.done[i] = make(chan struct{})
+	}
+
+	queue := make(chan int, len(units))
+	for i := range units {
+		queue <- i
+	}
+	close(queue)
+
+	for w := 0; w < jobs && w < len(units); w++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for i := range queue {
+				p.render(i)
+			}
+		}()
+	}
+
+	return p
+}
+
+func (p *RenderPool) render(i int) {
+	defer close(p.done[i])
+
+	if p.stopped.Load() {
+		p.results[i] = RenderResult{Unit: p.units[i], Err: errRenderSkipped}
+		return
+	}
+
+	var logs []slog.Record
+	p.results[i] = p.renderUnit(p.units[i], slog.New(&recordHandler{records: &logs}))
+	p.results[i].Logs = logs
+}
+
+func (p *RenderPool) renderUnit(u RenderUnit, logger *slog.Logger) RenderResult {
+	res := RenderResult{Unit: u}
+
+	prepared, err := u.Prepare(logger)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	if p.cache != nil {
+		inputHash, err := u.InputHash(prepared)
+		if err != nil {
+			logger.Warn("could not hash render inputs, rendering without cache", slog.String("path", u.Path), slog.String("error", err.Error()))
+		} else {
+			res.InputHash = inputHash
+
+			// Files keeping their permissions may have any mode
+			mode := u.FileMode()
+			if u.Options.KeepPermissions {
+				mode = 0
+			}
+			if files, ok := p.cache.Lookup(u.Path, inputHash, mode); ok {
+				res.Cached = true
+				for _, f := range files {
+					f.Mode = u.FileMode()
+					res.Files = append(res.Files, f)
+				}
+				return res
+			}
+		}
+	}
+
+	res.Files, res.Err = u.Execute(prepared, logger)
+
+	return res
+}
+
+// Next waits for the next unit in order and returns its result, replaying its
+// logs to the default logger first.
+func (p *RenderPool) Next() RenderResult {
+	i := p.next
+	p.next++
+	<-p.done[i]
+
+	res := p.results[i]
+	for _, r := range res.Logs {
+		handler := slog.Default().Handler()
+		if handler.Enabled(context.Background(), r.Level) {
+			handler.Handle(context.Background(), r)
+		}
+	}
+
+	return res
+}
+
+// Stop keeps the workers from starting units that are still queued and waits
+// for the units in flight.
+func (p *RenderPool) Stop() {
+	p.stopped.Store(true)
+	p.wg.Wait()
+}
+
+// recordHandler keeps the records logged by a single unit. Units render on a
+// single goroutine, so it needs no locking.
+type recordHandler struct {
+	records *[]slog.Record
+	attrs   []slog.Attr
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	r = r.Clone()
+	r.AddAttrs(h.attrs...)
+	*h.records = append(*h.records, r)
+
+	return nil
+}
+
+func (h *recordHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &recordHandler{
+		records: h.records,
+		attrs:   append(append([]slog.Attr(nil), h.attrs...), attrs...),
+	}
+}
+
+func (h *recordHandler) WithGroup(string) slog.Handler {
+	return h
+}
@@ -0,0 +1,109 @@
+package target
+
+import (
+	"log/slog"
+
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/innovation-upstream/codema/internal/template"
+	"github.com/pkg/errors"
+)
+
+// ProjectData is the data of project targets: the whole config, with the
+// models and enums of every microservice collected in config order.
+type ProjectData struct {
+	Config  config.Config
+	Apis    []config.ApiDefinition
+	Targets []config.Target
+	Models  []config.ModelDefinition
+	// Enums declared by several models are listed once
+	Enums []config.EnumDefinition
+}
+
+// ProjectTargetApi returns the target api of the units of a project target,
+// which is not one of the apis of the config.
+func ProjectTargetApi(t config.Target) config.TargetApi {
+	return config.TargetApi{OutPath: t.OutPath}
+}
+
+// PlanProject plans the single unit of a project target, which renders the
+// whole config.
+func (ctrl *TargetProcessorController) PlanProject(cfg *config.Config) ([]RenderUnit, error) {
+	pathTmplStr, err := template.NewPathTemplateString(ctrl.ParentTarget.OutPath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	tp := TargetProcessor{
+		ParentTarget: ctrl.ParentTarget,
+		TemplatesDir: ctrl.TemplatesDir,
+	}
+
+	ta := ProjectTargetApi(ctrl.ParentTarget)
+	targetTmplRaw, tmplPath, err := tp.getRawTemplate(ta)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	outFileSubPath, err := pathTmplStr.ExecuteProjectPathTemplate(template.ProjectPathTemplateInput{
+		Config: *cfg,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	path, err := absOutPath(outFileSubPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return []RenderUnit{{
+		Ctrl:         ctrl,
+		TargetApi:    ta,
+		Project:      cfg,
+		Options:      ctrl.ParentTarget.Options,
+		Path:         path,
+		TemplatePath: tmplPath,
+		templateRaw:  targetTmplRaw,
+		renderer:     ctrl.rendererFor(tmplPath),
+	}}, nil
+}
+
+func (ctrl *TargetProcessorController) prepareProjectFile(
+	templateStr string,
+	cfg config.Config,
+	syntax templateSyntax,
+	logger *slog.Logger,
+) PreparedUnit {
+	templateStr = preprocessTemplate(templateStr, config.MicroserviceDefinition{}, ctrl.TagRegistry, syntax, logger)
+
+	return PreparedUnit{
+		Template: templateStr,
+		Data:     newProjectData(cfg),
+	}
+}
+
+func newProjectData(cfg config.Config) ProjectData {
+	data := ProjectData{
+		Config:  cfg,
+		Apis:    cfg.Apis,
+		Targets: cfg.Targets,
+	}
+
+	seenEnums := make(map[string]bool)
+	for _, a := range cfg.Apis {
+		for _, ms := range a.Microservices {
+			models := append([]config.ModelDefinition{ms.PrimaryModel}, ms.SecondaryModels...)
+			for _, m := range models {
+				data.Models = append(data.Models, m)
+				for _, e := range m.Enums {
+					if !seenEnums[e.Name] {
+						seenEnums[e.Name] = true
+						data.Enums = append(data.Enums, e)
+					}
+				}
+			}
+		}
+	}
+
+	return data
+}
@@ -0,0 +1,122 @@
+package target
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Protected regions are declared by templates with a pair of marker lines,
+// in whatever comment syntax the generated language uses:
+//
+//	// codema:begin custom <id>
+//	// codema:end
+//
+// The lines between the markers in the existing file are kept when the file
+// is generated again.
+var (
+	regionBeginRegex = regexp.MustCompile(`codema:begin custom\s+([\w.\-]+)`)
+	regionEndRegex   = regexp.MustCompile(`codema:end\b`)
+	regionMarker     = []byte("codema:")
+)
+
+// region is a protected region, by the line indexes of its markers.
+type region struct {
+	id    string
+	begin int
+	end   int
+}
+
+// SpliceRegions copies the contents of the protected regions of existing into
+// the regions with the same id in generated. It returns the ids of regions
+// of existing that generated no longer declares, whose contents are dropped.
+func SpliceRegions(generated, existing []byte) ([]byte, []string, error) {
+	if !bytes.Contains(generated, regionMarker) && !bytes.Contains(existing, regionMarker) {
+		return generated, nil, nil
+	}
+
+	genLines := strings.SplitAfter(string(generated), "\n")
+	genRegions, err := parseRegions(genLines)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid protected regions in generated output")
+	}
+
+	oldLines := strings.SplitAfter(string(existing), "\n")
+	oldRegions, err := parseRegions(oldLines)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid protected regions in existing file")
+	}
+
+	oldById := make(map[string]region, len(oldRegions))
+	for _, r := range oldRegions {
+		oldById[r.id] = r
+	}
+
+	var out strings.Builder
+	next := 0
+	declared := make(map[string]bool, len(genRegions))
+	for _, r := range genRegions {
+		declared[r.id] = true
+
+		old, ok := oldById[r.id]
+		if !ok {
+			continue
+		}
+
+		for _, l := range genLines[next : r.begin+1] {
+			out.WriteString(l)
+		}
+		for _, l := range oldLines[old.begin+1 : old.end] {
+			out.WriteString(l)
+		}
+		next = r.end
+	}
+	for _, l := range genLines[next:] {
+		out.WriteString(l)
+	}
+
+	var dropped []string
+	for _, r := range oldRegions {
+		if !declared[r.id] {
+			dropped = append(dropped, r.id)
+		}
+	}
+
+	return []byte(out.String()), dropped, nil
+}
+
+func parseRegions(lines []string) ([]region, error) {
+	var regions []region
+	seen := make(map[string]bool)
+	open := -1
+	for i, l := range lines {
+		if m := regionBeginRegex.FindStringSubmatch(l); m != nil {
+			if open >= 0 {
+				return nil, errors.Errorf("line %d: region %s begins inside region %s", i+1, m[1], regions[open].id)
+			}
+			if seen[m[1]] {
+				return nil, errors.Errorf("line %d: duplicate region %s", i+1, m[1])
+			}
+			seen[m[1]] = true
+			regions = append(regions, region{id: m[1], begin: i})
+			open = len(regions) - 1
+			continue
+		}
+
+		if regionEndRegex.MatchString(l) {
+			if open < 0 {
+				return nil, errors.Errorf("line %d: region end without begin", i+1)
+			}
+			regions[open].end = i
+			open = -1
+		}
+	}
+
+	if open >= 0 {
+		return nil, errors.Errorf("region %s is not closed", regions[open].id)
+	}
+
+	return regions, nil
+}
@@ -0,0 +1,79 @@
+package target
+
+import (
+	"regexp"
+
+	targetrenderer "github.com/innovation-upstream/codema/internal/target-renderer"
+)
+
+// templateSyntax is what preprocessing looks for in the templates of a
+// renderer, whose actions are delimited differently.
+type templateSyntax struct {
+	// fieldTag matches actions referencing a field of the primary model by
+	// tag, with the text before the tag in the first group and the tag name
+	// in the second. Nil when the syntax has no field references
+	fieldTag *regexp.Regexp
+	// placeholder returns the pattern of a snippet placeholder like
+	// FUNCTION_IMPLEMENTATIONS
+	placeholder func(name string) *regexp.Regexp
+	// hook matches hook placeholders, with the hook name in the first group
+	hook *regexp.Regexp
+	// dropHooks removes hook placeholders once hooks are injected, when the
+	// renderer would not take them for comments
+	dropHooks bool
+	// primaryModel replaces @PM and @PrimaryModel, unless it is empty
+	primaryModel string
+}
+
+var (
+	goTemplateSyntax = templateSyntax{
+		fieldTag: regexp.MustCompile(`\{\{\W?([^}]*)?#(\w+)[^}]*}}`),
+		placeholder: func(name string) *regexp.Regexp {
+			tag := regexp.QuoteMeta("/* " + name + " */")
+			return regexp.MustCompile(`{{\s*` + tag + `\s*}}|` + tag)
+		},
+		hook:         regexp.MustCompile(`(?:{{)?/\* FUNCTION_IMPLEMENTATIONS\s+hook="((?:\w|\.)+)"\s+\*/(?:}})?`),
+		primaryModel: ".Microservice.PrimaryModel",
+	}
+
+	// plushSyntax takes placeholders in Plush comments, like
+	// <%# FUNCTION_IMPLEMENTATIONS %>
+	plushSyntax = templateSyntax{
+		// Comments are left out, as <%# opens them
+		fieldTag: regexp.MustCompile(`<%[=\s]\s*([^%]*?)#(\w+)[^%]*%>`),
+		placeholder: func(name string) *regexp.Regexp {
+			tag := regexp.QuoteMeta("/* " + name + " */")
+			return regexp.MustCompile(`<%#\s*` + regexp.QuoteMeta(name) + `\s*%>|` + tag)
+		},
+		hook:         regexp.MustCompile(`<%#\s*FUNCTION_IMPLEMENTATIONS\s+hook="((?:\w|\.)+)"\s*%>`),
+		primaryModel: "Microservice.PrimaryModel",
+	}
+
+	// starlarkSyntax takes placeholders in comment lines, like
+	// # FUNCTION_IMPLEMENTATIONS, which may be inside the string a template
+	// returns. Starlark templates reach the primary model and tagged fields
+	// through ctx
+	starlarkSyntax = templateSyntax{
+		placeholder: func(name string) *regexp.Regexp {
+			tag := regexp.QuoteMeta("/* " + name + " */")
+			return regexp.MustCompile(`(?m)#[ \t]*` + regexp.QuoteMeta(name) + `[ \t]*$|` + tag)
+		},
+		hook:      regexp.MustCompile(`(?m)#[ \t]*FUNCTION_IMPLEMENTATIONS\s+hook="((?:\w|\.)+)"[ \t]*$`),
+		dropHooks: true,
+	}
+)
+
+func syntaxOf(renderer targetrenderer.TargetRenderer) templateSyntax {
+	if renderer == nil {
+		return goTemplateSyntax
+	}
+
+	switch renderer.GetType() {
+	case targetrenderer.TargetRendererType_Plush:
+		return plushSyntax
+	case targetrenderer.TargetRendererType_Starlark:
+		return starlarkSyntax
+	}
+
+	return goTemplateSyntax
+}
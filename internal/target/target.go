@@ -27,6 +27,18 @@ type (
 		PluginRegistry *plugin.PluginRegistry
 		TagRegistry    tag.TagRegistry
 		ModelRegistry  model.ModelRegistry
+		// MergeBases is required by targets with the merge write policy
+		MergeBases *MergeBases
+		// WrittenFiles is required by targets with the overwrite-if-unmodified
+		// write policy
+		WrittenFiles WrittenFiles
+		// ConfigFile is the config named in provenance headers
+		ConfigFile string
+		// PartialsDir holds the partials shared by every template
+		PartialsDir string
+		Partials    targetrenderer.Partials
+		// TemplateFuncs are template functions defined by a Starlark config
+		TemplateFuncs config.TemplateFuncs
 	}
 
 	TargetProcessor struct {
@@ -34,18 +46,59 @@ type (
 		ParentTarget config.Target
 		TemplatesDir string
 	}
+
+	// RenderUnit is a single output of a target api: the api itself, one of
+	// its microservices, or a model, function or enum of a microservice,
+	// depending on what the target is rendered for each of.
+	// Units share no mutable state and may be rendered concurrently.
+	RenderUnit struct {
+		Ctrl         *TargetProcessorController
+		TargetApi    config.TargetApi
+		Api          config.ApiDefinition
+		Microservice *config.MicroserviceDefinition
+		Model        *config.ModelDefinition
+		Function     *config.FunctionImplementation
+		Enum         *config.EnumDefinition
+		// Project is the whole config for units of project targets
+		Project *config.Config
+		// Options are the options of the target, with the overrides of the
+		// front matter for files of template trees
+		Options      config.TargetOptions
+		Path         string
+		TemplatePath string
+		templateRaw  string
+		// templateTree is the template tree the template is part of
+		templateTree string
+		renderer     targetrenderer.TargetRenderer
+	}
+
+	GeneratedFile struct {
+		Path    string
+		Content []byte
+		Mode    os.FileMode
+		// MergeBase is the generated output before merging, written along
+		// with files of targets with the merge write policy
+		MergeBase *GeneratedFile
+		// Conflicts counts the conflict markers a merge left in Content
+		Conflicts int
+		// Kept means the write policy kept the file on disk as it was, so
+		// Content is the file on disk and only MergeBase, if any, is written
+		Kept bool
+	}
 )
 
-func (ctrl *TargetProcessorController) ProcessTargetApi(ta config.TargetApi) (int, error) {
+// PlanTargetApi resolves the template and output paths of a target api into
+// the units to render.
+func (ctrl *TargetProcessorController) PlanTargetApi(ta config.TargetApi) ([]RenderUnit, error) {
 	a, ok := ctrl.ApiRegistry[ta.Label]
 	if !ok {
 		msg := fmt.Sprintf("Could not find api: %s", ta.Label)
-		return 0, errors.New(msg)
+		return nil, errors.New(msg)
 	}
 
 	pathTmplStr, err := template.NewPathTemplateString(ta.OutPath)
 	if err != nil {
-		return 0, errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 
 	tp := TargetProcessor{
@@ -54,26 +107,31 @@ func (ctrl *TargetProcessorController) ProcessTargetApi(ta config.TargetApi) (in
 		TemplatesDir: ctrl.TemplatesDir,
 	}
 
-	targetTmplRaw, tmplPath, err := tp.getRawTemplate(ta)
-	if err != nil {
-		return 0, errors.WithStack(err)
+	unit := RenderUnit{
+		Ctrl:      ctrl,
+		TargetApi: ta,
+		Api:       a,
+		Options:   ctrl.ParentTarget.Options,
 	}
 
-	var renderer targetrenderer.TargetRenderer
-	switch true {
-	case strings.HasSuffix(tmplPath, ".plush"):
-		renderer = &targetrenderer.PlushTemplateTargetRenderer{}
-		break
-	case strings.HasSuffix(tmplPath, ".template") || strings.HasSuffix(tmplPath, ".gotemplate"):
-		renderer = &targetrenderer.GoTemplateTargetRenderer{}
-		break
-	default:
-		renderer = &targetrenderer.GoTemplateTargetRenderer{}
-		break
+	var treeRoot string
+	var treeFiles []treeFile
+	if ctrl.ParentTarget.TemplateTree != "" {
+		treeRoot, treeFiles, err = tp.getTemplateTree()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		unit.templateRaw, unit.TemplatePath, err = tp.getRawTemplate(ta)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		unit.renderer = ctrl.rendererFor(unit.TemplatePath)
 	}
 
-	var numFiles int
-	if ctrl.ParentTarget.Each {
+	scoped := []RenderUnit{unit}
+	if ctrl.ParentTarget.Each != config.EachApi {
+		scoped = nil
 	msLoop:
 		for _, m := range a.Microservices {
 			for _, sl := range ta.SkipLabels {
@@ -82,44 +140,372 @@ func (ctrl *TargetProcessorController) ProcessTargetApi(ta config.TargetApi) (in
 				}
 			}
 
-			msOutFileSubPath, err := pathTmplStr.ExecuteMicroservicePathTemplate(template.MicroservicePathTemplateInput{
-				Api:          a,
-				Microservice: m,
-				Label:        a.Label,
-			})
-			if err != nil {
-				return 0, errors.WithStack(err)
+			for _, item := range eachItems(m, ctrl.ParentTarget.Each) {
+				msUnit := unit
+				msUnit.Microservice = &m
+				msUnit.Model = item.model
+				msUnit.Function = item.function
+				msUnit.Enum = item.enum
+				scoped = append(scoped, msUnit)
 			}
+		}
+	}
 
-			msOutFilePath := config.ExpandModulePath(msOutFileSubPath)
+	var units []RenderUnit
+	for _, u := range scoped {
+		outFileSubPath, err := u.executePathTemplate(pathTmplStr)
+		if err != nil {
+			return nil, err
+		}
 
-			err = ctrl.renderEachFile(msOutFilePath, targetTmplRaw, a, m, renderer)
+		if treeRoot == "" {
+			u.Path, err = absOutPath(outFileSubPath)
 			if err != nil {
-				return 0, errors.WithStack(err)
+				return nil, err
 			}
+			units = append(units, u)
+			continue
+		}
 
-			numFiles++
+		// The out path of tree targets is the directory the tree renders into
+		for _, f := range treeFiles {
+			fileUnit, ok, err := u.planTreeFile(treeRoot, outFileSubPath, f)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				units = append(units, fileUnit)
+			}
 		}
+	}
+
+	return units, nil
+}
+
+// executePathTemplate executes a path template with the input of the scope
+// of the unit.
+func (u RenderUnit) executePathTemplate(pathTmplStr *template.PathTemplateString) (string, error) {
+	var path string
+	var err error
+	if u.Microservice != nil {
+		item := u.eachItem()
+		path, err = pathTmplStr.ExecuteMicroservicePathTemplate(template.MicroservicePathTemplateInput{
+			Api:          u.Api,
+			Microservice: *u.Microservice,
+			Label:        u.Api.Label,
+			Model:        derefOrZero(item.model),
+			Function:     derefOrZero(item.function),
+			Enum:         derefOrZero(item.enum),
+		})
 	} else {
-		apiOutFileSubPath, err := pathTmplStr.ExecuteApiPathTemplate(template.ApiPathTemplateInput{
-			Api:   a,
-			Label: a.Label,
+		path, err = pathTmplStr.ExecuteApiPathTemplate(template.ApiPathTemplateInput{
+			Api:   u.Api,
+			Label: u.Api.Label,
 		})
+	}
+
+	return path, errors.WithStack(err)
+}
+
+// rendererFor picks the renderer of a template by the engine of the target,
+// or else by its extension.
+func (ctrl *TargetProcessorController) rendererFor(tmplPath string) targetrenderer.TargetRenderer {
+	switch ctrl.ParentTarget.Engine {
+	case config.TemplateEngineGo:
+		return &targetrenderer.GoTemplateTargetRenderer{Partials: ctrl.Partials, Funcs: ctrl.TemplateFuncs}
+	case config.TemplateEnginePlush:
+		return &targetrenderer.PlushTemplateTargetRenderer{Partials: ctrl.Partials, Funcs: ctrl.TemplateFuncs}
+	case config.TemplateEngineStarlark:
+		return ctrl.starlarkRenderer(tmplPath)
+	}
+
+	switch true {
+	case strings.HasSuffix(tmplPath, ".plush"):
+		return &targetrenderer.PlushTemplateTargetRenderer{Partials: ctrl.Partials, Funcs: ctrl.TemplateFuncs}
+	case strings.HasSuffix(tmplPath, ".star"):
+		return ctrl.starlarkRenderer(tmplPath)
+	case strings.HasSuffix(tmplPath, ".template") || strings.HasSuffix(tmplPath, ".gotemplate"):
+		return &targetrenderer.GoTemplateTargetRenderer{Partials: ctrl.Partials, Funcs: ctrl.TemplateFuncs}
+	default:
+		return &targetrenderer.GoTemplateTargetRenderer{Partials: ctrl.Partials, Funcs: ctrl.TemplateFuncs}
+	}
+}
+
+func (ctrl *TargetProcessorController) starlarkRenderer(tmplPath string) targetrenderer.TargetRenderer {
+	return &targetrenderer.StarlarkTargetRenderer{
+		Name:     strings.TrimPrefix(tmplPath, ctrl.TemplatesDir),
+		Partials: ctrl.Partials,
+		Funcs:    ctrl.TemplateFuncs,
+	}
+}
+
+// eachItem is an item of a microservice a target renders one file for. All
+// fields are nil for targets rendered for each microservice.
+type eachItem struct {
+	model    *config.ModelDefinition
+	function *config.FunctionImplementation
+	enum     *config.EnumDefinition
+}
+
+func eachItems(ms config.MicroserviceDefinition, scope config.EachScope) []eachItem {
+	var items []eachItem
+	switch scope {
+	case config.EachModel:
+		items = append(items, eachItem{model: &ms.PrimaryModel})
+		fallthrough
+	case config.EachSecondaryModel:
+		for i := range ms.SecondaryModels {
+			items = append(items, eachItem{model: &ms.SecondaryModels[i]})
+		}
+	case config.EachFunction:
+		for i := range ms.FunctionImplementations {
+			items = append(items, eachItem{function: &ms.FunctionImplementations[i]})
+		}
+	case config.EachEnum:
+		// Enums may be declared by several models, they render once
+		seen := make(map[string]bool)
+		models := append([]config.ModelDefinition{ms.PrimaryModel}, ms.SecondaryModels...)
+		for mi := range models {
+			for ei := range models[mi].Enums {
+				enum := &models[mi].Enums[ei]
+				if seen[enum.Name] {
+					continue
+				}
+				seen[enum.Name] = true
+				items = append(items, eachItem{model: &models[mi], enum: enum})
+			}
+		}
+	default:
+		items = append(items, eachItem{})
+	}
+
+	return items
+}
+
+func (u RenderUnit) eachItem() eachItem {
+	return eachItem{
+		model:    u.Model,
+		function: u.Function,
+		enum:     u.Enum,
+	}
+}
+
+// snippetMicroservice returns ms with only the function implementations
+// whose snippets are injected for the item.
+func (i eachItem) snippetMicroservice(ms config.MicroserviceDefinition) config.MicroserviceDefinition {
+	if i.function != nil {
+		ms.FunctionImplementations = []config.FunctionImplementation{*i.function}
+	}
+
+	return ms
+}
+
+func derefOrZero[T any](v *T) T {
+	if v == nil {
+		var zero T
+		return zero
+	}
+
+	return *v
+}
+
+// absOutPath expands an output path and makes it absolute, so a file has a
+// single name however it was configured.
+func absOutPath(subPath string) (string, error) {
+	path, err := filepath.Abs(config.ExpandModulePath(subPath))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return path, nil
+}
+
+// Dependencies returns the files and directories the unit reads besides the
+// config: its template, its template tree, the partials, and the snippet,
+// imports and hook paths of the function implementations of its
+// microservice.
+func (u RenderUnit) Dependencies() []string {
+	deps := []string{u.TemplatePath}
+	// Files added to the tree are only picked up by planning again
+	if u.templateTree != "" {
+		deps = append(deps, u.templateTree)
+	}
+	if u.Ctrl.PartialsDir != "" {
+		deps = append(deps, u.Ctrl.PartialsDir)
+	}
+	if u.Microservice == nil {
+		return deps
+	}
+
+	for _, funcImpl := range u.eachItem().snippetMicroservice(*u.Microservice).FunctionImplementations {
+		snippetPaths, ok := funcImpl.TargetSnippets[u.Ctrl.ParentTarget.Label]
+		if !ok {
+			continue
+		}
+		for _, p := range []string{snippetPaths.ContentPath, snippetPaths.ImportsPath, snippetPaths.HooksDirectory} {
+			if p != "" {
+				deps = append(deps, u.Ctrl.TemplatesDir+p)
+			}
+		}
+	}
+
+	return deps
+}
+
+// PreparedUnit holds the template of a unit after snippet injection and
+// preprocessing, together with the data it is rendered with.
+type PreparedUnit struct {
+	Template string
+	Data     interface{}
+}
+
+// Prepare injects snippets into the template of the unit and preprocesses
+// it, logging to logger.
+func (u RenderUnit) Prepare(logger *slog.Logger) (PreparedUnit, error) {
+	syntax := syntaxOf(u.renderer)
+	if u.Project != nil {
+		return u.Ctrl.prepareProjectFile(u.templateRaw, *u.Project, syntax, logger), nil
+	}
+	if u.Microservice != nil {
+		return u.Ctrl.prepareEachFile(u.templateRaw, u.Api, *u.Microservice, u.eachItem(), syntax, logger)
+	}
+
+	return u.Ctrl.prepareSingleFile(u.templateRaw, u.Api, syntax, logger), nil
+}
+
+// Execute renders a prepared unit into the file at its path and the files
+// its template emits with file blocks. Every file gets the provenance header,
+// keeps the protected regions of the file on disk, runs through the target
+// plugins, is normalized and has the write policy of the target applied.
+// Nothing is written to disk.
+func (u RenderUnit) Execute(prepared PreparedUnit, logger *slog.Logger) ([]GeneratedFile, error) {
+	result, err := u.renderer.Render(prepared.Template, prepared.Data, logger)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	content, emitted, err := targetrenderer.SplitFiles(result)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []GeneratedFile
+	// Templates made of file blocks only have no file of their own
+	if len(emitted) == 0 || content != "" {
+		f, err := u.finishFile(u.Path, content, prepared, logger)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	seen := map[string]bool{u.Path: true}
+	for _, e := range emitted {
+		path, err := u.emittedPath(e.Path)
+		if err != nil {
+			return nil, err
+		}
+		if seen[path] {
+			return nil, errors.Errorf("file %s is emitted more than once", path)
+		}
+		seen[path] = true
+
+		f, err := u.finishFile(path, e.Content, prepared, logger)
 		if err != nil {
-			return 0, errors.WithStack(err)
+			return nil, errors.Wrapf(err, "emitted file %s", path)
 		}
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+// Render prepares and executes the unit.
+func (u RenderUnit) Render(logger *slog.Logger) ([]GeneratedFile, error) {
+	prepared, err := u.Prepare(logger)
+	if err != nil {
+		return nil, err
+	}
 
-		apiOutFilePath := config.ExpandModulePath(apiOutFileSubPath)
+	return u.Execute(prepared, logger)
+}
+
+// emittedPath resolves the path of a file block against the directory of the
+// out path of the unit.
+func (u RenderUnit) emittedPath(path string) (string, error) {
+	path = config.ExpandModulePath(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(u.Path), path)
+	}
 
-		err = ctrl.renderSingleFile(apiOutFilePath, targetTmplRaw, a, renderer)
+	return absOutPath(path)
+}
+
+// finishFile turns rendered content into the file at path.
+func (u RenderUnit) finishFile(path, result string, prepared PreparedUnit, logger *slog.Logger) (GeneratedFile, error) {
+	var err error
+	if u.Options.Header {
+		result, err = u.addProvenanceHeader(path, result, prepared, logger)
 		if err != nil {
-			return 0, errors.WithStack(err)
+			return GeneratedFile{}, err
 		}
+	}
 
-		numFiles++
+	// Regions are spliced before plugins run, so plugins like goimports see
+	// the custom code too
+	content, err := spliceExistingRegions(path, []byte(result), logger)
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	content, err = u.Ctrl.runPlugins(path, content)
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	f := GeneratedFile{
+		Path:    path,
+		Content: normalizeContent(content, u.Options),
+		Mode:    u.FileMode(),
+	}
+
+	return u.applyWritePolicy(f, logger)
+}
+
+// spliceExistingRegions keeps the protected regions of the file previously
+// generated at path.
+func spliceExistingRegions(path string, content []byte, logger *slog.Logger) ([]byte, error) {
+	existing, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return content, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
 	}
 
-	return numFiles, nil
+	content, dropped, err := SpliceRegions(content, existing)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range dropped {
+		logger.Warn("Protected region is no longer in the template, its content is dropped", slog.String("path", path), slog.String("region", id))
+	}
+
+	return content, nil
+}
+
+func (u RenderUnit) FileMode() os.FileMode {
+	options := u.Options
+	fileMode := options.FileMode
+	if fileMode == 0 {
+		// Merged files are meant to be edited
+		if options.WritePolicy == config.WritePolicyMerge || options.KeepPermissions {
+			return 0644
+		}
+		return 0444
+	}
+
+	return fileMode
 }
 
 func getTemplateVersionPath(defaultVersion, version string) string {
@@ -161,78 +547,84 @@ func (tp *TargetProcessor) getRawTemplate(
 	return templateContent, tmplPath, nil
 }
 
-func (ctrl *TargetProcessorController) renderEachFile(
-	path, templateRaw string,
+func (ctrl *TargetProcessorController) prepareEachFile(
+	templateRaw string,
 	api config.ApiDefinition,
 	ms config.MicroserviceDefinition,
-	renderer targetrenderer.TargetRenderer,
-) error {
+	item eachItem,
+	syntax templateSyntax,
+	logger *slog.Logger,
+) (PreparedUnit, error) {
 	targetLabel := ctrl.ParentTarget.Label
 	templatesDir := ctrl.TemplatesDir
-	pluginReg := ctrl.PluginRegistry
 
-	// Create the directory structure
-	dir := filepath.Dir(path)
-	err := os.MkdirAll(dir, 0755)
+	// Inject function implementation snippets, only those of the function
+	// when rendering for each function
+	templateRaw, err := injectFunctionImplementationSnippets(templateRaw, item.snippetMicroservice(ms), targetLabel, templatesDir, syntax)
 	if err != nil {
-		return errors.Wrap(err, "failed to create directory structure")
+		return PreparedUnit{}, errors.WithStack(err)
 	}
 
-	os.Chmod(path, 0666)
-	file, err := os.Create(path)
-	if err != nil {
-		return errors.WithStack(err)
+	// Tag references resolve against the model when rendering for each model
+	tagMs := ms
+	if item.model != nil {
+		tagMs.PrimaryModel = *item.model
 	}
-	defer file.Close()
+	templateRaw = preprocessTemplate(templateRaw, tagMs, ctrl.TagRegistry, syntax, logger)
 
-	// Inject function implementation snippets
-	templateRaw, err = injectFunctionImplementationSnippets(templateRaw, ms, targetLabel, templatesDir)
-	if err != nil {
-		return errors.WithStack(err)
-	}
+	return PreparedUnit{
+		Template: templateRaw,
+		Data:     newEachData(api, ms, item),
+	}, nil
+}
 
-	templateRaw = preprocessTemplate(templateRaw, ms, ctrl.TagRegistry)
+// eachData is the data of units rendered for each microservice, or each
+// model, function or enum of one.
+type eachData struct {
+	Api          config.ApiDefinition
+	Microservice config.MicroserviceDefinition
+	Model        config.ModelDefinition
+	Function     config.FunctionImplementation
+	Enum         config.EnumDefinition
+}
 
-	data := struct {
-		Api          config.ApiDefinition
-		Microservice config.MicroserviceDefinition
-	}{
+func newEachData(api config.ApiDefinition, ms config.MicroserviceDefinition, item eachItem) eachData {
+	return eachData{
 		Api:          api,
 		Microservice: ms,
+		Model:        derefOrZero(item.model),
+		Function:     derefOrZero(item.function),
+		Enum:         derefOrZero(item.enum),
 	}
+}
 
-	result, err := renderer.Render(templateRaw, data)
-	if err != nil {
-		return errors.WithStack(err)
+// templateData returns the data the unit is rendered with.
+func (u RenderUnit) templateData() interface{} {
+	if u.Project != nil {
+		return newProjectData(*u.Project)
+	}
+	if u.Microservice != nil {
+		return newEachData(u.Api, *u.Microservice, u.eachItem())
 	}
 
-	content := []byte(result)
-	for _, p := range pluginReg.GetPlugins(targetLabel) {
+	return u.Api
+}
+
+func (ctrl *TargetProcessorController) runPlugins(path string, content []byte) ([]byte, error) {
+	for _, p := range ctrl.PluginRegistry.GetPlugins(ctrl.ParentTarget.Label) {
 		var err error
 		content, err = p.PreWriteFile(context.Background(), path, content)
 		if err != nil {
-			return errors.Wrap(err, "plugin execution failed")
+			return nil, errors.Wrap(err, "plugin execution failed")
 		}
 	}
 
-	_, err = file.Write(content)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
-	fileMode := ctrl.ParentTarget.Options.FileMode
-	if fileMode == 0 {
-		os.Chmod(path, 0444)
-	} else {
-		os.Chmod(path, fileMode)
-	}
-
-	return nil
+	return content, nil
 }
 
-func replacePlaceholder(templateRaw, placeholderTag, content string, repeat bool) string {
-	// Define a regex pattern that makes {{ and }} optional around the placeholder
-	placeholderPattern := regexp.MustCompile(`{{\s*` + regexp.QuoteMeta(placeholderTag) + `\s*}}|` + regexp.QuoteMeta(placeholderTag))
+func replacePlaceholder(templateRaw, placeholderName, content string, repeat bool, syntax templateSyntax) string {
+	// The placeholder may stand on its own or be wrapped in an action
+	placeholderPattern := syntax.placeholder(placeholderName)
 
 	return placeholderPattern.ReplaceAllStringFunc(templateRaw, func(match string) string {
 		if repeat {
@@ -247,6 +639,7 @@ func injectFunctionImplementationSnippets(
 	ms config.MicroserviceDefinition,
 	targetLabel string,
 	templatesDir string,
+	syntax templateSyntax,
 ) (string, error) {
 	for _, funcImpl := range ms.FunctionImplementations {
 		snippetPaths, ok := funcImpl.TargetSnippets[targetLabel]
@@ -255,7 +648,7 @@ func injectFunctionImplementationSnippets(
 		}
 
 		// Handle hook property
-		re := regexp.MustCompile(`(?:{{)?/\* FUNCTION_IMPLEMENTATIONS\s+hook="((?:\w|\.)+)"\s+\*/(?:}})?`)
+		re := syntax.hook
 		templateRaw = re.ReplaceAllStringFunc(templateRaw, func(match string) string {
 			hookName := re.FindStringSubmatch(match)[1]
 			if snippetPaths.HooksDirectory != "" {
@@ -289,109 +682,77 @@ func injectFunctionImplementationSnippets(
 			}
 		}
 
-		templateRaw = replacePlaceholder(templateRaw, "/* FUNCTION_IMPLEMENTATIONS */", string(snippetContent), true)
-		templateRaw = replacePlaceholder(templateRaw, "/* FUNCTION_IMPORTS */", string(importsContent), true)
+		templateRaw = replacePlaceholder(templateRaw, "FUNCTION_IMPLEMENTATIONS", string(snippetContent), true, syntax)
+		templateRaw = replacePlaceholder(templateRaw, "FUNCTION_IMPORTS", string(importsContent), true, syntax)
 	}
 
-	templateRaw = replacePlaceholder(templateRaw, "/* FUNCTION_IMPLEMENTATIONS */", "", false)
-	templateRaw = replacePlaceholder(templateRaw, "/* FUNCTION_IMPORTS */", "", false)
+	templateRaw = replacePlaceholder(templateRaw, "FUNCTION_IMPLEMENTATIONS", "", false, syntax)
+	templateRaw = replacePlaceholder(templateRaw, "FUNCTION_IMPORTS", "", false, syntax)
+	if syntax.dropHooks {
+		templateRaw = syntax.hook.ReplaceAllString(templateRaw, "")
+	}
 
 	return templateRaw, nil
 }
 
-func (ctrl *TargetProcessorController) renderSingleFile(
-	path,
+func (ctrl *TargetProcessorController) prepareSingleFile(
 	templateStr string,
 	api config.ApiDefinition,
-	renderer targetrenderer.TargetRenderer,
-) error {
-	targetLabel := ctrl.ParentTarget.Label
-	pluginReg := ctrl.PluginRegistry
-
-	// Create the directory structure
-	dir := filepath.Dir(path)
-	err := os.MkdirAll(dir, 0755)
-	if err != nil {
-		return errors.Wrap(err, "failed to create directory structure")
-	}
-
-	os.Chmod(path, 0666)
-	file, err := os.Create(path)
-	if err != nil {
-		return errors.WithStack(err)
+	syntax templateSyntax,
+	logger *slog.Logger,
+) PreparedUnit {
+	templateStr = preprocessTemplate(templateStr, config.MicroserviceDefinition{}, ctrl.TagRegistry, syntax, logger)
+
+	return PreparedUnit{
+		Template: templateStr,
+		Data:     api,
 	}
-	defer file.Close()
-
-	templateStr = preprocessTemplate(templateStr, config.MicroserviceDefinition{}, ctrl.TagRegistry)
-
-	result, err := renderer.Render(templateStr, api)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
-	content := []byte(result)
-	for _, p := range pluginReg.GetPlugins(targetLabel) {
-		var err error
-		content, err = p.PreWriteFile(context.Background(), path, content)
-		if err != nil {
-			return errors.Wrap(err, "plugin execution failed")
-		}
-	}
-
-	_, err = file.Write(content)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
-	fileMode := ctrl.ParentTarget.Options.FileMode
-	if fileMode == 0 {
-		os.Chmod(path, 0444)
-	} else {
-		os.Chmod(path, fileMode)
-	}
-
-	return nil
 }
 
 func preprocessTemplate(
 	templateStr string,
 	ms config.MicroserviceDefinition,
 	tagReg tag.TagRegistry,
+	syntax templateSyntax,
+	logger *slog.Logger,
 ) string {
 	// Replace @PM# or @PrimaryModel# or # followed by a tag name
-	re := regexp.MustCompile(`\{\{\W?([^}]*)?#(\w+)[^}]*}}`)
-	templateStr = re.ReplaceAllStringFunc(templateStr, func(match string) string {
-		groups := re.FindStringSubmatch(match)
-		before := groups[1]
-		tagName := groups[2]
-
-		for _, field := range ms.PrimaryModel.Fields {
-			for _, fieldTag := range field.Tags {
-				if fieldTag.Name == tagName {
-					if before == "" {
-						return field.Name
-					} else {
-						return strings.Replace(match, "#"+tagName, field.Name, -1)
+	if re := syntax.fieldTag; re != nil {
+		templateStr = re.ReplaceAllStringFunc(templateStr, func(match string) string {
+			groups := re.FindStringSubmatch(match)
+			before := groups[1]
+			tagName := groups[2]
+
+			for _, field := range ms.PrimaryModel.Fields {
+				for _, fieldTag := range field.Tags {
+					if fieldTag.Name == tagName {
+						if before == "" {
+							return field.Name
+						} else {
+							return strings.Replace(match, "#"+tagName, field.Name, -1)
+						}
 					}
 				}
 			}
-		}
 
-		slog.Warn("got no field for tag", slog.String("tag", tagName), slog.String("model", ms.PrimaryModel.Name))
+			logger.Warn("got no field for tag", slog.String("tag", tagName), slog.String("model", ms.PrimaryModel.Name))
 
-		return match // If no matching tag is found, return the original match
-	})
+			return match // If no matching tag is found, return the original match
+		})
+	}
 
-	templateStr = resolveTagReferences(templateStr, tagReg.GetTagByName)
+	templateStr = resolveTagReferences(templateStr, tagReg.GetTagByName, logger)
 
 	// Replace @PM or @PrimaryModel with {{ .Microservice.PrimaryModel }}
-	re = regexp.MustCompile(`@PM|@PrimaryModel`)
-	templateStr = re.ReplaceAllString(templateStr, ".Microservice.PrimaryModel")
+	if syntax.primaryModel != "" {
+		re := regexp.MustCompile(`@PM|@PrimaryModel`)
+		templateStr = re.ReplaceAllString(templateStr, syntax.primaryModel)
+	}
 
 	return templateStr
 }
 
-func resolveTagReferences(template string, resolveTag func(string) config.TagDefinition) string {
+func resolveTagReferences(template string, resolveTag func(string) config.TagDefinition, logger *slog.Logger) string {
 	re := regexp.MustCompile(`@Tags\.[^\W.]+`)
 	matches := re.FindAllString(template, -1)
 
@@ -400,7 +761,7 @@ func resolveTagReferences(template string, resolveTag func(string) config.TagDef
 		tag := resolveTag(tagName)
 		if tag.Name == "" {
 			msg := fmt.Sprintf("not found: %s", tagName)
-			slog.Warn(msg)
+			logger.Warn(msg)
 			template = strings.ReplaceAll(template, match, "\"TAG_NOT_FOUND\"")
 			return template
 		}
@@ -0,0 +1,205 @@
+package target
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// WriteTransaction writes a set of generated files all or nothing. Every
+	// file is first written to a temp file next to it, and only when all of
+	// them were written are they renamed into place. When a rename fails, the
+	// files already renamed are restored to their previous content and mode.
+	WriteTransaction struct {
+		files []GeneratedFile
+	}
+
+	stagedWrite struct {
+		file    GeneratedFile
+		tmpPath string
+		// existed, prevContent and prevMode describe the file before the
+		// transaction, to restore it on rollback
+		existed     bool
+		prevContent []byte
+		prevMode    os.FileMode
+		// createdDirs are the directories created for the file, deepest first
+		createdDirs []string
+	}
+)
+
+// Add adds a file, along with its merge base when it has one, so the two
+// are always written together.
+func (t *WriteTransaction) Add(f GeneratedFile) {
+	t.files = append(t.files, f)
+	if f.MergeBase != nil {
+		t.files = append(t.files, *f.MergeBase)
+	}
+}
+
+func (t *WriteTransaction) Len() int {
+	return len(t.files)
+}
+
+// Commit writes every added file. When it fails, the files and directories
+// on disk are left as they were before.
+func (t *WriteTransaction) Commit() error {
+	staged := make([]*stagedWrite, 0, len(t.files))
+	defer func() {
+		for _, s := range staged {
+			if s.tmpPath != "" {
+				os.Remove(s.tmpPath)
+			}
+		}
+	}()
+
+	for _, f := range t.files {
+		s, err := stageWrite(f)
+		if s != nil {
+			staged = append(staged, s)
+		}
+		if err != nil {
+			return withRollback(errors.Wrapf(err, "failed to write %s", f.Path), rollback(staged, 0))
+		}
+	}
+
+	for i, s := range staged {
+		err := os.Rename(s.tmpPath, s.file.Path)
+		if err != nil {
+			return withRollback(errors.Wrapf(err, "failed to write %s", s.file.Path), rollback(staged, i))
+		}
+		s.tmpPath = ""
+	}
+
+	return nil
+}
+
+// stageWrite records the current state of the file and writes its new
+// content to a temp file. The returned staged write is set whenever anything
+// was created on disk, even on error, so it can be rolled back.
+func stageWrite(f GeneratedFile) (*stagedWrite, error) {
+	s := &stagedWrite{file: f}
+
+	info, err := os.Stat(f.Path)
+	if err == nil {
+		s.existed = true
+		s.prevMode = info.Mode().Perm()
+		s.prevContent, err = os.ReadFile(f.Path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, errors.WithStack(err)
+	}
+
+	s.createdDirs, err = mkdirAllTracked(filepath.Dir(f.Path))
+	if err != nil {
+		return s, errors.Wrap(err, "failed to create directory structure")
+	}
+
+	s.tmpPath, err = writeTempFile(filepath.Dir(f.Path), f.Content, f.Mode)
+	if err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// rollback restores the first renamed staged files in reverse order, then
+// removes the directories created for all of them.
+func rollback(staged []*stagedWrite, renamed int) error {
+	var firstErr error
+	for i := renamed - 1; i >= 0; i-- {
+		err := staged[i].restore()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for i := len(staged) - 1; i >= 0; i-- {
+		s := staged[i]
+		if s.tmpPath != "" {
+			os.Remove(s.tmpPath)
+			s.tmpPath = ""
+		}
+		// Directories still holding other files are kept
+		for _, dir := range s.createdDirs {
+			os.Remove(dir)
+		}
+	}
+
+	return firstErr
+}
+
+func (s *stagedWrite) restore() error {
+	if !s.existed {
+		return errors.Wrapf(os.Remove(s.file.Path), "failed to remove %s", s.file.Path)
+	}
+
+	tmpPath, err := writeTempFile(filepath.Dir(s.file.Path), s.prevContent, s.prevMode)
+	if err != nil {
+		return errors.Wrapf(err, "failed to restore %s", s.file.Path)
+	}
+
+	err = os.Rename(tmpPath, s.file.Path)
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrapf(err, "failed to restore %s", s.file.Path)
+	}
+
+	return nil
+}
+
+func withRollback(err, rollbackErr error) error {
+	if rollbackErr != nil {
+		return errors.Wrapf(err, "rolling back failed: %v", rollbackErr)
+	}
+
+	return err
+}
+
+// writeTempFile writes content with mode to a new hidden file in dir, so it
+// can be renamed over its destination atomically.
+func writeTempFile(dir string, content []byte, mode os.FileMode) (string, error) {
+	file, err := os.CreateTemp(dir, ".codema-*.tmp")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), mode)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", errors.WithStack(err)
+	}
+
+	return file.Name(), nil
+}
+
+// mkdirAllTracked creates dir and its missing parents, returning the
+// directories it created, deepest first.
+func mkdirAllTracked(dir string) ([]string, error) {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return missing, errors.WithStack(err)
+	}
+
+	return missing, nil
+}
@@ -0,0 +1,177 @@
+package target
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/innovation-upstream/codema/internal/config"
+	"github.com/innovation-upstream/codema/internal/fs"
+	targetrenderer "github.com/innovation-upstream/codema/internal/target-renderer"
+	"github.com/innovation-upstream/codema/internal/template"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	// treeFile is a file of the template tree of a target.
+	treeFile struct {
+		path string
+		// outPath is the path template of the output relative to the out
+		// path of the target api
+		outPath     *template.PathTemplateString
+		frontMatter string
+		body        string
+	}
+
+	// FrontMatter is the YAML block between --- lines that may open a file
+	// of a template tree. It is rendered as a Go template with the data of
+	// the file before it is parsed, so it can depend on the data.
+	FrontMatter struct {
+		// Skip leaves the file out
+		Skip        bool               `yaml:"skip"`
+		WritePolicy config.WritePolicy `yaml:"writePolicy"`
+		FileMode    os.FileMode        `yaml:"fileMode"`
+	}
+)
+
+// frontMatterDelimiter is the line opening and closing front matter
+const frontMatterDelimiter = "---"
+
+// treeTemplateExtensions are the extensions stripped from the names of tree
+// files, one per file.
+var treeTemplateExtensions = []string{".template", ".gotemplate", ".plush", ".star"}
+
+// getTemplateTree reads every file of the template tree of the target, in
+// lexical order.
+func (tp *TargetProcessor) getTemplateTree() (string, []treeFile, error) {
+	root := fs.GetLegacyTemplatePath(tp.TemplatesDir, tp.ParentTarget.TemplateTree)
+
+	var files []treeFile
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		outPath, err := template.NewPathTemplateString(stripTemplateExtension(rel))
+		if err != nil {
+			return errors.Wrapf(err, "invalid path %s", path)
+		}
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		frontMatter, body := splitFrontMatter(string(raw))
+
+		files = append(files, treeFile{
+			path:        path,
+			outPath:     outPath,
+			frontMatter: frontMatter,
+			body:        body,
+		})
+		return nil
+	})
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to read template tree %s", root)
+	}
+
+	return root, files, nil
+}
+
+// stripTemplateExtension strips the template extension of a tree file name,
+// so x.tmpl.template renders x.tmpl.
+func stripTemplateExtension(name string) string {
+	for _, ext := range treeTemplateExtensions {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+
+	return name
+}
+
+// splitFrontMatter returns the front matter of a tree file and the rest of
+// it. The front matter is closed by a --- line, which may end the file.
+func splitFrontMatter(raw string) (string, string) {
+	first, rest, found := strings.Cut(raw, "\n")
+	if !found || first != frontMatterDelimiter {
+		return "", raw
+	}
+
+	for start := 0; ; {
+		line, next, found := strings.Cut(rest[start:], "\n")
+		if line == frontMatterDelimiter {
+			return strings.TrimSuffix(rest[:start], "\n"), next
+		}
+		if !found {
+			return "", raw
+		}
+		start += len(line) + 1
+	}
+}
+
+// planTreeFile turns a unit of a tree target into the unit of one file of
+// the tree. It returns false when the front matter skips the file.
+func (u RenderUnit) planTreeFile(root, outRoot string, f treeFile) (RenderUnit, bool, error) {
+	u.TemplatePath = f.path
+	u.templateTree = root
+	u.templateRaw = f.body
+	u.renderer = u.Ctrl.rendererFor(f.path)
+
+	if f.frontMatter != "" {
+		fm, err := u.parseFrontMatter(f.frontMatter)
+		if err != nil {
+			return u, false, errors.Wrapf(err, "invalid front matter in %s", f.path)
+		}
+		if fm.Skip {
+			return u, false, nil
+		}
+		if fm.WritePolicy != "" {
+			u.Options.WritePolicy = fm.WritePolicy
+		}
+		if fm.FileMode != 0 {
+			u.Options.FileMode = fm.FileMode
+		}
+		err = u.Options.Validate()
+		if err != nil {
+			return u, false, errors.Wrapf(err, "invalid front matter in %s", f.path)
+		}
+	}
+
+	rel, err := u.executePathTemplate(f.outPath)
+	if err != nil {
+		return u, false, err
+	}
+
+	u.Path, err = absOutPath(filepath.Join(outRoot, rel))
+	if err != nil {
+		return u, false, err
+	}
+
+	return u, true, nil
+}
+
+func (u RenderUnit) parseFrontMatter(raw string) (FrontMatter, error) {
+	var fm FrontMatter
+	// Front matter is rendered while planning, before units have loggers
+	rendered, err := (&targetrenderer.GoTemplateTargetRenderer{Funcs: u.Ctrl.TemplateFuncs}).Render(raw, u.templateData(), slog.Default())
+	if err != nil {
+		return fm, errors.WithStack(err)
+	}
+
+	err = yaml.UnmarshalStrict([]byte(rendered), &fm)
+	if err != nil {
+		return fm, errors.WithStack(err)
+	}
+
+	return fm, nil
+}
@@ -0,0 +1,51 @@
+package target
+
+import "testing"
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name            string
+		raw             string
+		wantFrontMatter string
+		wantBody        string
+	}{
+		{name: "no front matter", raw: "body\n", wantBody: "body\n"},
+		{name: "front matter", raw: "---\nskip: true\n---\nbody\n", wantFrontMatter: "skip: true", wantBody: "body\n"},
+		{name: "several lines", raw: "---\na: 1\nb: 2\n---\nbody", wantFrontMatter: "a: 1\nb: 2", wantBody: "body"},
+		{name: "empty front matter", raw: "---\n---\nbody", wantBody: "body"},
+		{name: "closed at the end of the file", raw: "---\nskip: true\n---", wantFrontMatter: "skip: true"},
+		{name: "closed by a newline at the end of the file", raw: "---\nskip: true\n---\n", wantFrontMatter: "skip: true"},
+		{name: "not closed", raw: "---\nskip: true\nbody", wantBody: "---\nskip: true\nbody"},
+		{name: "delimiter within a line", raw: "---\na: ---\n---\nb", wantFrontMatter: "a: ---", wantBody: "b"},
+		{name: "opening delimiter alone", raw: "---", wantBody: "---"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frontMatter, body := splitFrontMatter(tt.raw)
+			if frontMatter != tt.wantFrontMatter || body != tt.wantBody {
+				t.Errorf("splitFrontMatter(%q) = %q, %q, want %q, %q", tt.raw, frontMatter, body, tt.wantFrontMatter, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestStripTemplateExtension(t *testing.T) {
+	tests := map[string]string{
+		"main.go.template":      "main.go",
+		"main.go.gotemplate":    "main.go",
+		"index.html.plush":      "index.html",
+		"BUILD.star":            "BUILD",
+		"x.tmpl.template":       "x.tmpl",
+		"x.template.template":   "x.template",
+		"x.star.template":       "x.star",
+		"README.md":             "README.md",
+		"dir/schema.star.plush": "dir/schema.star",
+	}
+
+	for name, want := range tests {
+		if got := stripTemplateExtension(name); got != want {
+			t.Errorf("stripTemplateExtension(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
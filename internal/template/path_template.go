@@ -15,16 +15,25 @@ type (
 		template *template.Template
 	}
 
+	// MicroservicePathTemplateInput is the input of targets rendered for each
+	// microservice, or each model, function or enum of one, which is set
 	MicroservicePathTemplateInput struct {
 		Label        string
 		Microservice config.MicroserviceDefinition
 		Api          config.ApiDefinition
+		Model        config.ModelDefinition
+		Function     config.FunctionImplementation
+		Enum         config.EnumDefinition
 	}
 
 	ApiPathTemplateInput struct {
 		Label string
 		Api   config.ApiDefinition
 	}
+
+	ProjectPathTemplateInput struct {
+		Config config.Config
+	}
 )
 
 func NewPathTemplateString(outPath string) (*PathTemplateString, error) {
@@ -65,3 +74,16 @@ func (ps PathTemplateString) ExecuteApiPathTemplate(
 
 	return pathSb.String(), nil
 }
+
+func (ps PathTemplateString) ExecuteProjectPathTemplate(
+	input ProjectPathTemplateInput,
+) (string, error) {
+	var pathSb strings.Builder
+	err := ps.template.Execute(&pathSb, input)
+	if err != nil {
+		msg := fmt.Sprintf("Error executing path template: %+v", err)
+		return "", errors.New(msg)
+	}
+
+	return pathSb.String(), nil
+}